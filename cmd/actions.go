@@ -0,0 +1,224 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/speak"
+	"github.com/rhuss/puffer/pkg/trigger"
+)
+
+// action is run when a trigger fires
+type action func(event trigger.Event) error
+
+// actionConfig describes a custom action in the "actions" section
+type actionConfig struct {
+	// One of "template", "shell", "calendar" or "chain"
+	Type string
+
+	// template: text/template to speak
+	Template string
+
+	// shell: command run with "sh -c" and whether to speak its output
+	Command string
+	Speak   bool
+
+	// calendar: time range of the events to speak, like "tomorrow" or "weekend"
+	When string
+
+	// chain: names of actions to run one after the other
+	Actions []string
+}
+
+// templateData is available in the templates of custom actions
+type templateData struct {
+	Trigger string
+	Payload string
+}
+
+// loadActions creates the built-in actions and the custom actions from
+// the configuration
+func loadActions() (map[string]action, error) {
+	actions := map[string]action{
+		"puffer":   func(trigger.Event) error { return speakPufferSummary() },
+		"calendar": func(trigger.Event) error { return speakCalendar() },
+		"dnd":      doNotDisturbAction,
+		"say": func(event trigger.Event) error {
+			if event.Payload == "" {
+				return nil
+			}
+			return announce(event.Payload)
+		},
+		"stop": func(trigger.Event) error {
+			speak.Stop()
+			return nil
+		},
+	}
+
+	configs := map[string]*actionConfig{}
+	if err := unmarshalKey("actions", &configs); err != nil {
+		return nil, fmt.Errorf("invalid actions configuration: %v", err)
+	}
+	for name, config := range configs {
+		if _, found := actions[name]; found {
+			return nil, fmt.Errorf("action %s is built-in and cannot be redefined", name)
+		}
+		var err error
+		switch config.Type {
+		case "template":
+			actions[name], err = templateAction(name, config)
+		case "shell":
+			actions[name], err = shellAction(name, config)
+		case "calendar":
+			actions[name], err = calendarAction(name, config)
+		case "chain":
+			// resolved below as they refer to other actions
+		default:
+			err = fmt.Errorf("unknown type '%s' for action %s", config.Type, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name := range configs {
+		if _, err := chainAction(name, configs, actions, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return actions, nil
+}
+
+// templateAction speaks a text created from a template. Besides the trigger
+// data, the function "puffer" can be used for accessing the puffer data
+func templateAction(name string, config *actionConfig) (action, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"puffer": fetchPufferInfo,
+	}).Parse(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for action %s: %v", name, err)
+	}
+	return func(event trigger.Event) error {
+		var text bytes.Buffer
+		if err := tmpl.Execute(&text, templateData{Trigger: event.Trigger, Payload: event.Payload}); err != nil {
+			return err
+		}
+		return announce(text.String())
+	}, nil
+}
+
+// shellAction runs a command and optionally speaks its output. The trigger
+// data is available in the environment variables PUFFER_TRIGGER and PUFFER_PAYLOAD
+func shellAction(name string, config *actionConfig) (action, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("no command given for action %s", name)
+	}
+	return func(event trigger.Event) error {
+		cmd := exec.Command("sh", "-c", config.Command)
+		cmd.Env = append(os.Environ(), "PUFFER_TRIGGER="+event.Trigger, "PUFFER_PAYLOAD="+event.Payload)
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("command of action %s failed: %v", name, err)
+		}
+		if text := strings.TrimSpace(string(output)); config.Speak && text != "" {
+			return announce(text)
+		}
+		return nil
+	}, nil
+}
+
+// calendarAction speaks the events within the time range given by "when"
+func calendarAction(name string, config *actionConfig) (action, error) {
+	if _, err := calendar.ParseWindow(config.When, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid time range for action %s: %v", name, err)
+	}
+	return func(trigger.Event) error {
+		msgs, err := getWindowMessages(config.When, language)
+		if err != nil {
+			return err
+		}
+		return announceAll(msgs)
+	}, nil
+}
+
+// chainAction resolves an action by name, creating chain actions on the way
+func chainAction(name string, configs map[string]*actionConfig, actions map[string]action, resolving map[string]bool) (action, error) {
+	if a, found := actions[name]; found {
+		return a, nil
+	}
+	config, found := configs[name]
+	if !found {
+		return nil, fmt.Errorf("unknown action %s", name)
+	}
+	if resolving[name] {
+		return nil, fmt.Errorf("action chain %s refers to itself", name)
+	}
+	resolving[name] = true
+
+	steps := []action{}
+	for _, step := range config.Actions {
+		a, err := chainAction(step, configs, actions, resolving)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, a)
+	}
+	chain := func(event trigger.Event) error {
+		for _, step := range steps {
+			if err := step(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	actions[name] = chain
+	return chain, nil
+}
+
+// speakPufferSummary speaks the current puffer temperatures
+func speakPufferSummary() error {
+	msg, err := getPufferSummaryMessage(language)
+	if err != nil {
+		return err
+	}
+	return announce(msg)
+}
+
+// speakCalendar speaks the next calendar events
+func speakCalendar() error {
+	msgs, err := getCalendarMessages(language)
+	if err != nil {
+		return err
+	}
+	return announceAll(msgs)
+}
+
+// announceAll announces the messages one after the other
+func announceAll(msgs []string) error {
+	for _, msg := range msgs {
+		if err := announce(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
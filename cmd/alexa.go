@@ -15,58 +15,321 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	alexa "github.com/mikeflynn/go-alexa/skillserver"
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/rhuss/puffer/pkg/puffer"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	alexa "github.com/mikeflynn/go-alexa/skillserver"
-	"path/filepath"
-	"log"
 )
 
+var alexaLog = logging.New("alexa")
+
+// The skillserver only verifies requests below /echo/, so the skill is always
+// registered here internally and a differently configured path is mapped onto it
+const alexaRoute = "/echo/puffer"
+
 // watchCmd represents the watch command
 var alexaCmd = &cobra.Command{
 	Use:   "alexa",
-	Short: "Alexa Skill server",
-	Long: `Provide Alexa skills for puffer information`,
-	Run: alexaRun,
+	Short: "Alexa Skill and voice assistant webhook server",
+	Long: `Provide Alexa skills and a webhook for puffer information
+
+	The server is configured in the "alexa" section of the configuration:
+
+	- port : Port to listen on (default: 8443)
+	- bind : Address to bind to (default: all interfaces)
+	- path : Route of the skill endpoint (default: /echo/puffer)
+	- tls  : Whether to terminate TLS locally with server.crt and server.key
+	         from the config dir (default: true). Switch this off when running
+	         behind a reverse proxy which terminates TLS.
+	- cert, key : Alternative paths to certificate and key
+
+	On the same server a generic webhook for other voice assistants is
+	provided, which understands Dialogflow fulfillment requests as well as
+	a simple {"query": "...", "language": "de"} request answered with
+	{"speech": "..."}. It is configured in the "webhook" section:
+
+	- path  : Route of the webhook (default: /webhook/puffer)
+	- token : Token required as bearer token in the Authorization header.
+	          Without it, the webhook isn't served.
+	`,
+	RunE: alexaRun,
+}
+
+// alexaReplayCmd replays recorded requests against the skill handlers
+var alexaReplayCmd = &cobra.Command{
+	Use:   "replay <request.json> ...",
+	Short: "Replay recorded Alexa requests against the skill",
+	Long: `Replay recorded Alexa request JSON files against the skill handlers
+
+	No server is started and the Amazon signature verification is skipped,
+	so that the skill can be tested offline. For every request file "foo.json"
+	an expected response "foo.response.json" is looked up next to it. If found,
+	the spoken text of both is compared and a mismatch is reported as failure.
+
+	Recorded requests with their responses are kept in cmd/testdata/alexa
+	and replayed by "go test ./cmd/".
+	`,
+	RunE: alexaReplay,
 }
 
 var config map[string]string
 
+var replayPufferData string
 
-func alexaRun(cmd *cobra.Command, args []string) {
+func alexaRun(cmd *cobra.Command, args []string) error {
 	config = viper.GetStringMapString("alexa")
 	port, found := config["port"]
 	if !found {
 		port = "8443"
 	}
-	certPath := filepath.Join(viper.GetString("configdir"), "server.crt")
-	keyPath := filepath.Join(viper.GetString("configdir"), "server.key")
+	path, found := config["path"]
+	if !found {
+		path = alexaRoute
+	}
+	useTLS := true
+	if tlsConfig, found := config["tls"]; found {
+		var err error
+		if useTLS, err = strconv.ParseBool(tlsConfig); err != nil {
+			return configErrorf("Invalid value for alexa.tls: %s", tlsConfig)
+		}
+	}
 
+	webhookConfig := viper.GetStringMapString("webhook")
+	webhookPath, found := webhookConfig["path"]
+	if !found {
+		webhookPath = "/webhook/puffer"
+	}
+
+	handler := http.NewServeMux()
+	handler.Handle(path, alexaHandler())
+	if webhookConfig["token"] != "" {
+		handler.Handle(webhookPath, webhookHandler(webhookConfig["token"]))
+		alexaLog.Infof("Webhook on %s", webhookPath)
+	} else {
+		alexaLog.Infof("Webhook not served without webhook.token")
+	}
+	server := &http.Server{
+		Addr:    config["bind"] + ":" + port,
+		Handler: handler,
+	}
+	go shutdownOnSignal(server)
+	startCalendarSync()
+
+	var err error
+	if useTLS {
+		certPath := configPath(config["cert"], "server.crt")
+		keyPath := configPath(config["key"], "server.key")
+		alexaLog.Infof("Alexa Skillserver Listening on %s%s (TLS)", server.Addr, path)
+		err = server.ListenAndServeTLS(certPath, keyPath)
+	} else {
+		alexaLog.Infof("Alexa Skillserver Listening on %s%s", server.Addr, path)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	alexaLog.Infof("Alexa Skillserver stopped")
+	return nil
+}
 
+// alexaHandler creates the HTTP handler serving the skill. Requests are mapped
+// onto the internal route so that it can be mounted at any path. The "_dev"
+// parameter is dropped, as the skillserver doesn't verify requests with it
+func alexaHandler() http.Handler {
+	router := alexaRouter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = alexaRoute
+		query := r.URL.Query()
+		query.Del("_dev")
+		r.URL.RawQuery = query.Encode()
+		router.ServeHTTP(w, r)
+	})
+}
+
+// alexaReplayHandler creates the handler for replaying recorded requests,
+// whose signature and timestamp are not verified
+func alexaReplayHandler() http.Handler {
+	router := alexaRouter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = alexaRoute
+		r.URL.RawQuery = "_dev=replay"
+		router.ServeHTTP(w, r)
+	})
+}
+
+func alexaRouter() *mux.Router {
 	var applications = map[string]interface{}{
-		"/echo/puffer": alexa.EchoApplication{ // Route
+		alexaRoute: alexa.EchoApplication{ // Route
 			AppID:    config["appid"],
-			OnIntent: PufferHandler,
+			OnIntent: IntentHandler,
 			OnLaunch: PufferHandler,
 		},
 	}
+	router := mux.NewRouter()
+	alexa.Init(applications, router)
+	return router
+}
+
+// shutdownOnSignal gracefully stops the server on SIGINT or SIGTERM
+func shutdownOnSignal(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	alexaLog.Infof("Received %v, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		alexaLog.Warnf("Cannot shutdown gracefully: %v", err)
+	}
+}
 
-	log.Printf("Alexa Skillserver Listening on port %s", port)
-	err := alexa.RunSSL(applications, ":" + port, certPath,keyPath)
+// configPath returns the given path or, if empty, the file in the config dir
+func configPath(path string, file string) string {
+	if path != "" {
+		return path
+	}
+	return filepath.Join(viper.GetString("configdir"), file)
+}
+
+func alexaReplay(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return configErrorf("No request files given")
+	}
+	config = viper.GetStringMapString("alexa")
+	if replayPufferData != "" {
+		fetchPufferInfo = pufferInfoFromFile(replayPufferData)
+	}
+	handler := alexaReplayHandler()
+
+	failed := 0
+	for _, file := range args {
+		ok, err := replayRequest(handler, file)
+		if err != nil {
+			return fmt.Errorf("Cannot replay %s: %v", file, err)
+		}
+		if !ok {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replayed requests failed", failed, len(args))
+	}
+	return nil
+}
+
+// replayRequest sends a single recorded request to the handler and compares
+// the answer with the expected response, if any
+func replayRequest(handler http.Handler, file string) (bool, error) {
+	body, err := ioutil.ReadFile(file)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
+	}
+	req, err := http.NewRequest("POST", alexaRoute, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		fmt.Printf("FAIL %s: HTTP %d %s\n", file, rec.Code, rec.Body.String())
+		return false, nil
+	}
+
+	actual, err := replaySpeech(rec.Body.Bytes())
+	if err != nil {
+		return false, err
+	}
+	expectedFile := strings.TrimSuffix(file, filepath.Ext(file)) + ".response.json"
+	expectedBody, err := ioutil.ReadFile(expectedFile)
+	if os.IsNotExist(err) {
+		fmt.Printf("---- %s: %s\n", file, actual)
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	expected, err := replaySpeech(expectedBody)
+	if err != nil {
+		return false, err
+	}
+	if expected != actual {
+		fmt.Printf("FAIL %s\n     expected: %s\n     actual:   %s\n", file, expected, actual)
+		return false, nil
+	}
+	fmt.Printf("OK   %s: %s\n", file, actual)
+	return true, nil
+}
+
+// replaySpeech extracts the spoken text from an Alexa response
+func replaySpeech(body []byte) (string, error) {
+	var resp alexa.EchoResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Response.OutputSpeech == nil {
+		return "", nil
+	}
+	return resp.Response.OutputSpeech.Text, nil
+}
+
+// pufferInfoFromFile returns a fetcher for puffer data recorded as JSON
+func pufferInfoFromFile(file string) func() (*puffer.Info, error) {
+	return func() (*puffer.Info, error) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		info := &puffer.Info{}
+		if err := json.Unmarshal(data, info); err != nil {
+			return nil, err
+		}
+		return info, nil
 	}
 }
 
 func PufferHandler(echoReq *alexa.EchoRequest, echoResp *alexa.EchoResponse) {
-	msg, err := getPufferSummaryMessage()
+	msg, err := getPufferSummaryMessage(language)
+	if err != nil {
+		alexaLog.Errorf("Cannot answer launch request: %v", err)
+		msg = Texts["failure"][language]
+	}
+	echoResp.OutputSpeech(msg).Card("Puffer", msg)
+}
+
+// IntentHandler answers an intent request with the handler registered for
+// the intent name, e.g. "CalendarIntent". Unknown intents get the puffer summary.
+// The time range is taken from the slot "when" of type AMAZON.DATE
+func IntentHandler(echoReq *alexa.EchoRequest, echoResp *alexa.EchoResponse) {
+	intent := resolveIntent(echoReq.GetIntentName())
+	when, _ := echoReq.GetSlotValue("when")
+	msg, err := answerIntent(intent, language, when)
 	if err != nil {
-		log.Fatal(err)
+		alexaLog.Errorf("Cannot answer intent %s: %v", intent, err)
+		msg = Texts["failure"][language]
 	}
 	echoResp.OutputSpeech(msg).Card("Puffer", msg)
 }
 
 func init() {
 	RootCmd.AddCommand(alexaCmd)
-}
+	alexaCmd.AddCommand(alexaReplayCmd)
 
+	alexaReplayCmd.Flags().StringVar(&replayPufferData, "puffer-data", "", "JSON file with puffer data to use instead of querying InfluxDB")
+}
@@ -0,0 +1,117 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const alexaTestAppID = "amzn1.ask.skill.puffer-test"
+
+// withAlexaReplay sets up the skill as the replay command does, with the
+// recorded puffer data of the fixtures
+func withAlexaReplay(appID string) func() {
+	oldConfig, oldFetch, oldLanguage := config, fetchPufferInfo, language
+	config = map[string]string{"appid": appID}
+	fetchPufferInfo = pufferInfoFromFile(filepath.Join("testdata", "alexa", "puffer-data.json"))
+	language = "de"
+	return func() {
+		config, fetchPufferInfo, language = oldConfig, oldFetch, oldLanguage
+	}
+}
+
+func TestAlexaReplayFixtures(t *testing.T) {
+	defer withAlexaReplay(alexaTestAppID)()
+	handler := alexaReplayHandler()
+
+	for _, name := range []string{"launch", "puffer-intent", "unknown-intent"} {
+		ok, err := replayRequest(handler, filepath.Join("testdata", "alexa", name+".json"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !ok {
+			t.Errorf("%s: answer differs from %s.response.json", name, name)
+		}
+	}
+}
+
+func TestAlexaReplayDetectsChangedAnswer(t *testing.T) {
+	defer withAlexaReplay(alexaTestAppID)()
+	dir, err := ioutil.TempDir("", "alexa-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	request, err := ioutil.ReadFile(filepath.Join("testdata", "alexa", "launch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "launch.json")
+	expected := `{"version": "1.0", "response": {"outputSpeech": {"type": "PlainText", "text": "Puffer. Oben : 20 Grad."}}}`
+	if err := ioutil.WriteFile(file, request, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "launch.response.json"), []byte(expected), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := replayRequest(alexaReplayHandler(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("changed answer not detected")
+	}
+}
+
+func TestAlexaReplayRejectsOtherSkill(t *testing.T) {
+	defer withAlexaReplay("amzn1.ask.skill.other")()
+
+	ok, err := replayRequest(alexaReplayHandler(), filepath.Join("testdata", "alexa", "launch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("request for another skill has been answered")
+	}
+}
+
+func TestAlexaHandlerVerifiesRequests(t *testing.T) {
+	defer withAlexaReplay(alexaTestAppID)()
+	request, err := ioutil.ReadFile(filepath.Join("testdata", "alexa", "launch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unsigned request is rejected, even when asking to skip the checks
+	for _, path := range []string{"/alexa", "/alexa?_dev=1", "/alexa?lang=de&_dev=replay"} {
+		req, err := http.NewRequest("POST", path, bytes.NewReader(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		alexaHandler().ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			t.Errorf("%s: unverified request answered with %s", path, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/policy"
+	"github.com/rhuss/puffer/pkg/trigger"
+	"github.com/spf13/viper"
+)
+
+// announcePolicy is consulted before every announcement. Without a policy,
+// e.g. when called directly via "puffer speak", everything is announced
+var announcePolicy *policy.Policy
+
+// announceQueue holds suppressed announcements if configured
+var announceQueue *policy.Queue
+
+// announce speaks a text unless the policy suppresses it
+func announce(text string) error {
+	if announcePolicy != nil {
+		now := time.Now()
+		if reason := announcePolicy.Check(now); reason != "" {
+			if announceQueue != nil {
+				watchLog.Infof("Queued announcement (%s): %s", reason, text)
+				announceQueue.Add(text, now)
+			} else {
+				watchLog.Infof("Suppressed announcement (%s): %s", reason, text)
+			}
+			return nil
+		}
+	}
+	return speakText(text)
+}
+
+// deliverQueued speaks all queued announcements once the policy allows it
+func deliverQueued() {
+	if announceQueue == nil || announceQueue.Len() == 0 {
+		return
+	}
+	now := time.Now()
+	if announcePolicy.Check(now) != "" {
+		return
+	}
+	for _, text := range announceQueue.Drain(now) {
+		if err := speakText(text); err != nil {
+			watchLog.Errorf("Cannot speak %v : %v", text, err)
+		}
+	}
+}
+
+// setupPolicy creates the announcement policy from the "policy" section.
+// Presence is detected from the DHCP server log if presses of the buttons
+// are, so that no packets need to be captured
+func setupPolicy(buttons *trigger.ButtonSource, quietHours policy.QuietHours) error {
+	var presence *policy.Presence
+	if devices := viper.GetStringSlice("policy.presence.devices"); len(devices) > 0 {
+		timeout := viper.GetDuration("policy.presence.timeout")
+		if timeout == 0 {
+			timeout = 15 * time.Minute
+		}
+		var err error
+		if presence, err = policy.NewPresence(devices, timeout); err != nil {
+			return err
+		}
+		if buttons.ReadsLogs() {
+			buttons.ObserveClients(presence.Seen)
+		} else {
+			ifaces, err := watchInterfaces()
+			if err != nil {
+				return err
+			}
+			for _, iface := range ifaces {
+				if err := presence.Watch(iface); err != nil {
+					return fmt.Errorf("cannot watch for presence on %s: %v", iface.Name, err)
+				}
+			}
+		}
+	}
+
+	announcePolicy = policy.New(quietHours, presence)
+
+	if viper.GetBool("policy.queue") {
+		maxAge := viper.GetDuration("policy.queue_max_age")
+		if maxAge == 0 {
+			maxAge = 12 * time.Hour
+		}
+		announceQueue = policy.NewQueue(maxAge)
+	}
+	return nil
+}
+
+// loadQuietHours reads "policy.quiet_hours", which apply to announcements
+// as well as to scheduled triggers. The former "schedule.quiet_hours" is
+// still accepted for all days
+func loadQuietHours() (policy.QuietHours, error) {
+	specs := viper.GetStringMapStringSlice("policy.quiet_hours")
+	if viper.IsSet("schedule.quiet_hours") {
+		if len(specs) > 0 {
+			return nil, fmt.Errorf("both policy.quiet_hours and schedule.quiet_hours are given, use only policy.quiet_hours")
+		}
+		scheduleLog.Warnf("schedule.quiet_hours is deprecated, use policy.quiet_hours with \"default\" instead")
+		specs = map[string][]string{"default": viper.GetStringSlice("schedule.quiet_hours")}
+	}
+	quietHours, err := policy.ParseQuietHours(specs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours: %v", err)
+	}
+	return quietHours, nil
+}
+
+// doNotDisturbAction switches "do not disturb" on or off depending on the
+// payload ("on", "off"). Without payload it is toggled
+func doNotDisturbAction(event trigger.Event) error {
+	if announcePolicy == nil {
+		return fmt.Errorf("no announcement policy active")
+	}
+	switch strings.ToLower(strings.TrimSpace(event.Payload)) {
+	case "on", "true", "1":
+		announcePolicy.SetDoNotDisturb(true)
+	case "off", "false", "0":
+		announcePolicy.SetDoNotDisturb(false)
+	case "", "toggle":
+		announcePolicy.SetDoNotDisturb(!announcePolicy.DoNotDisturb())
+	default:
+		return fmt.Errorf("invalid payload '%s' for do not disturb", event.Payload)
+	}
+	watchLog.Infof("Do not disturb switched %s", map[bool]string{true: "on", false: "off"}[announcePolicy.DoNotDisturb()])
+	return nil
+}
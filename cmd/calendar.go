@@ -0,0 +1,880 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+var calendarLog = logging.New("calendar")
+
+var calendarCmd = &cobra.Command{
+	Use:   "calendar [when]",
+	Short: "Show the events of the calendars",
+	Long: `Show or speak the events of the calendars
+
+	Without argument, the events of today are shown or, if there are none
+	left, those of tomorrow, together with tomorrow's all-day events. Else
+	the events within the given time range are shown grouped by day:
+
+	- today, tomorrow      : The (rest of the) day
+	- week, next-week      : The rest of this week or the next week
+	- weekend              : The coming or current weekend
+	- monday, next-monday  : The coming Monday or the one after, likewise
+	                         for the other days of the week
+	- 7d                   : The next seven days
+	- 2017-06-24           : A date
+	- 2017-06-24..2017-06-26 : A range of dates
+	- 2017-W25, 2017-W25-WE, 2017-06 : A week, its weekend or a month
+
+	Time ranges can't be longer than a year. With --speak the events are spoken instead.
+
+	Google calendars are read with the permission of a user, which is
+	granted once with "puffer calendar auth". Alternatively a service
+	account can be used without any interactive consent:
+
+	  google:
+	    # JSON key of the service account, relative to the config directory
+	    service_account: service-account.json
+	    # Optional user to act for, needs domain-wide delegation in
+	    # Google Workspace
+	    subject: roland@example.com
+
+	Without subject, the calendars must be shared with the email address of
+	the service account and given by their ID in the calendar lists, like
+	"family123@group.calendar.google.com".
+
+	Calendars in the lists "calendars", "allday" and "schedule.holidays" are
+	given by their name or in detail. Google calendars are found by their
+	name regardless of case, by the name given to a calendar shared with
+	you or by their ID, which is shown in the calendar's settings and
+	doesn't change when the calendar is renamed. Commands running
+	permanently like watch warn at startup about calendars which can't be
+	found:
+
+	  calendars:
+	    - name: family123@group.calendar.google.com
+	      # Name to speak instead of the calendar's name
+	      alias: Family
+	      # Only events matching one of these and none of those in exclude
+	      include: ["(?i)school", "(?i)doctor"]
+	      exclude: ["^Focus time$"]
+	      # Declined events and timed events marked as free are left out
+	      # unless these are set
+	      show_declined: false
+	      show_free: false
+	      # Private events are announced as "private appointment" (mask),
+	      # left out (hide) or announced as they are (show)
+	      private: mask
+	    - name: Team
+	      # google (default), caldav or ics
+	      type: caldav
+	      url: https://cloud.example.com/remote.php/dav/calendars/roland/team/
+	      user: roland
+	      password: secret
+
+	Timed events can be announced with details:
+
+	  event_details:
+	    # Add the location, shortened to the part before the first comma
+	    location: true
+	    # Add the names of up to three other attendees
+	    attendees: false
+	    # Add when to leave, by keywords contained in the location. "default"
+	    # applies to all other events with a location
+	    travel:
+	      office: 30m
+	      school: 15m
+
+	The events are kept in copies in calendar-cache in the config directory,
+	which are synced incrementally:
+
+	  calendar_cache:
+	    # Copies older than this are synced before they are used, 0
+	    # disables the copies (default 10m). Commands running permanently
+	    # like watch, listen and alexa sync every half of it in the
+	    # background, so that they answer without waiting
+	    max_age: 10m
+	    # How long copies are used while the calendars can't be reached
+	    offline: 24h
+	`,
+}
+
+var calendarAuthCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Authorize the access to the Google calendars",
+	Long: `Authorize the access to the Google calendars and store the token.
+
+	Open the shown URL in a browser, which redirects to a temporary server
+	on localhost after the access has been granted. This needs a client
+	secret of type "Desktop app" in google-client-secret.json in the config
+	directory. Google's device flow, where a code is entered on another
+	device, can't be used, as it doesn't allow access to calendars.
+
+	On a machine without a browser like a Raspberry Pi, pick a port and
+	forward it from the machine with the browser:
+
+	  ssh -L 8085:localhost:8085 pi@puffer
+	  puffer calendar auth --port 8085
+
+	Then open the URL on the machine running ssh.
+
+	The token is stored in calendar-token.json in the config directory and
+	updated whenever it gets refreshed. Run this command again when puffer
+	asks to authorize the calendar access again.
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return authorizeCalendar()
+	},
+}
+
+var calendarAuthPort int
+var calendarSpeak bool
+
+// Names of the days of the week, starting with Sunday, and of the months
+var weekdayNames = map[string][]string{
+	"de": {"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	"en": {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+}
+
+var monthNames = map[string][]string{
+	"de": {"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	"en": {"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+}
+
+func showCalendar(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return configErrorf("only one time range can be given")
+	}
+	var msgs []string
+	var err error
+	if len(args) == 0 {
+		msgs, err = getCalendarMessages(language)
+	} else {
+		msgs, err = getWindowMessages(args[0], language)
+	}
+	if err != nil {
+		return err
+	}
+	if calendarSpeak {
+		return announceAll(msgs)
+	}
+	for _, msg := range msgs {
+		fmt.Println(msg)
+	}
+	return nil
+}
+
+func init() {
+	calendarCmd.RunE = showCalendar
+	calendarCmd.Flags().BoolVar(&calendarSpeak, "speak", false, "Speak the events instead of printing them")
+	calendarAuthCmd.Flags().IntVar(&calendarAuthPort, "port", 0, "Port on localhost the browser is redirected to (default any free one)")
+	calendarCmd.AddCommand(calendarAuthCmd)
+	RootCmd.AddCommand(calendarCmd)
+}
+
+// calendarConfig describes an entry of the calendar lists "calendars",
+// "allday" and "schedule.holidays". Entries given just by name are Google
+// calendars
+type calendarConfig struct {
+	Name string
+	// "google" (default), "caldav" or "ics"
+	Type string
+	// caldav: URL of the calendar collection, ics: URL or file of the feed
+	URL      string
+	User     string
+	Password string
+
+	// Name to speak instead of the calendar's name
+	Alias string
+	// Regular expressions for the summaries of events to announce or to leave out
+	Include []string
+	Exclude []string
+	// Whether to announce declined events and timed events marked as free
+	ShowDeclined bool `mapstructure:"show_declined"`
+	ShowFree     bool `mapstructure:"show_free"`
+	// Private events are announced as "private appointment" ("mask", default),
+	// left out ("hide") or announced as they are ("show")
+	Private string
+}
+
+// getCalendarMessages fetches the next events and converts them into
+// the messages to speak in the given language
+func getCalendarMessages(lang string) ([]string, error) {
+	details, err := loadEventDetails()
+	if err != nil {
+		return nil, err
+	}
+	var events *calendar.NextEvents
+	today, allDay, err := calendarLists()
+	if err == nil {
+		events, err = calendar.GetNextEvents(today, allDay)
+	}
+	if err != nil {
+		return calendarFailure(err, lang)
+	}
+
+	msgs := []string{}
+	if events.OngoingEvents != nil {
+		for _, event := range *events.OngoingEvents {
+			msgs = append(msgs, getOngoingMessage(event, lang))
+		}
+	}
+	if events.TodayAllDayEvents != nil {
+		msgs = append(msgs, Texts["cal-all-day-today"][lang])
+		for _, event := range *events.TodayAllDayEvents {
+			msgs = append(msgs, getAllDayMessage(event, lang))
+		}
+	}
+	if events.TodayEvents != nil {
+		for _, event := range *events.TodayEvents {
+			msgs = append(msgs, getEventMessage(event, lang, details))
+		}
+	} else {
+		if events.OngoingEvents != nil || events.TodayAllDayEvents != nil {
+			msgs = append(msgs, Texts["cal-none-further"][lang])
+		} else {
+			msgs = append(msgs, Texts["cal-none"][lang])
+		}
+		if events.TomorrowEvents != nil {
+			msgs = append(msgs, Texts["cal-tomorrow"][lang])
+			for _, event := range *events.TomorrowEvents {
+				msgs = append(msgs, getEventMessage(event, lang, details))
+			}
+		}
+	}
+
+	if events.TomorrowAllDayEvents != nil {
+		msgs = append(msgs, Texts["cal-reminder-tomorrow"][lang])
+		for _, event := range *events.TomorrowAllDayEvents {
+			msgs = append(msgs, getAllDayMessage(event, lang))
+		}
+	}
+	return msgs, nil
+}
+
+// getWindowMessages fetches the events within the time range and converts
+// them into the messages to speak in the given language, one or more per day
+func getWindowMessages(when string, lang string) ([]string, error) {
+	w, err := calendar.ParseWindow(when, time.Now())
+	if err != nil {
+		return nil, configErrorf("%v", err)
+	}
+	details, err := loadEventDetails()
+	if err != nil {
+		return nil, err
+	}
+	var days []calendar.Day
+	today, allDay, err := calendarLists()
+	if err == nil {
+		days, err = calendar.GetEvents(today, allDay, w)
+	}
+	if err != nil {
+		return calendarFailure(err, lang)
+	}
+
+	if len(days) == 0 {
+		return []string{Texts["cal-none-window"][lang]}, nil
+	}
+	msgs := []string{}
+	for _, day := range days {
+		msgs = append(msgs, fmt.Sprintf(Texts["cal-day"][lang], dayName(day.Date, lang)))
+		for _, event := range day.AllDay {
+			msgs = append(msgs, getAllDayMessage(event, lang))
+		}
+		for _, event := range day.Ongoing {
+			msgs = append(msgs, getOngoingMessage(event, lang))
+		}
+		for _, event := range day.Timed {
+			msgs = append(msgs, getEventMessage(event, lang, details))
+		}
+	}
+	return msgs, nil
+}
+
+// dayName names a day relative to today or by its date
+func dayName(date time.Time, lang string) string {
+	year, month, day := time.Now().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+	switch {
+	case date.Equal(today):
+		return Texts["cal-today"][lang]
+	case date.Equal(today.AddDate(0, 0, 1)):
+		return Texts["cal-tomorrow-day"][lang]
+	}
+	return fmt.Sprintf(Texts["cal-date"][lang],
+		weekdayNames[lang][date.Weekday()], date.Day(), monthNames[lang][date.Month()-1])
+}
+
+// calendarLists creates the providers for the calendars with timed events
+// and those with all-day events
+func calendarLists() ([]calendar.Provider, []calendar.Provider, error) {
+	today, err := calendarProviders("calendars")
+	if err != nil {
+		return nil, nil, err
+	}
+	allDay, err := calendarProviders("allday")
+	if err != nil {
+		return nil, nil, err
+	}
+	return today, allDay, nil
+}
+
+// calendarFailure turns a missing authorization into a message asking to
+// authorize again, which is better spoken than just failing
+func calendarFailure(err error, lang string) ([]string, error) {
+	forgetCalendars(err)
+	if failure.Kind(err) == calendar.ErrReauthorize {
+		calendarLog.Warnf("%v", err)
+		return []string{Texts["cal-reauthorize"][lang]}, nil
+	}
+	return nil, err
+}
+
+// calendarSets holds the providers of the calendar lists, so that the
+// calendars are looked up only once and their copies are kept in memory.
+// Lists missing a Google calendar aren't kept
+var calendarSets = struct {
+	sync.Mutex
+	cache *calendar.Cache
+	lists map[string][]calendar.Provider
+}{lists: map[string][]calendar.Provider{}}
+
+// calendarProviders returns the providers for the calendars listed under
+// the given key, which are created on first use
+func calendarProviders(key string) ([]calendar.Provider, error) {
+	calendarSets.Lock()
+	defer calendarSets.Unlock()
+	if providers, found := calendarSets.lists[key]; found {
+		return providers, nil
+	}
+	if calendarSets.cache == nil {
+		cache, err := calendarCache()
+		if err != nil {
+			return nil, err
+		}
+		calendarSets.cache = cache
+	}
+	providers, complete, err := newCalendarProviders(key, calendarSets.cache)
+	if err != nil {
+		return nil, err
+	}
+	// Calendars not found are looked up again next time, as they may have
+	// been created or shared in the meantime
+	if complete {
+		calendarSets.lists[key] = providers
+	}
+	return providers, nil
+}
+
+// forgetCalendars drops the providers when the access needs to be authorized
+// again, so that they are created with the new token after authorizing
+func forgetCalendars(err error) {
+	if failure.Kind(err) == calendar.ErrReauthorize {
+		calendarSets.Lock()
+		defer calendarSets.Unlock()
+		calendarSets.lists = map[string][]calendar.Provider{}
+	}
+}
+
+// calendarCache creates the cache for the copies of the calendars as
+// configured in "calendar_cache". A max_age of 0 disables it
+func calendarCache() (*calendar.Cache, error) {
+	maxAge, err := configDuration("calendar_cache.max_age", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	offline, err := configDuration("calendar_cache.offline", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if maxAge <= 0 {
+		return nil, nil
+	}
+	return calendar.NewCache(filepath.Join(viper.GetString("configdir"), "calendar-cache"), maxAge, offline), nil
+}
+
+// configDuration reads a duration from the configuration
+func configDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	if !viper.IsSet(key) {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(viper.GetString(key))
+	if err != nil {
+		return 0, configErrorf("invalid duration for %s: %v", key, err)
+	}
+	return d, nil
+}
+
+// startCalendarSync checks the configured calendars and keeps their copies
+// up to date in the background, so that announcements don't wait for the
+// calendar services
+func startCalendarSync() {
+	maxAge, err := configDuration("calendar_cache.max_age", 10*time.Minute)
+	if err != nil {
+		calendarLog.Warnf("%v", err)
+	}
+	go func() {
+		checkCalendars()
+		if err != nil || maxAge <= 0 {
+			return
+		}
+		for {
+			time.Sleep(maxAge / 2)
+			if err := syncCalendars(); err != nil {
+				calendarLog.Warnf("Cannot sync calendars: %v", err)
+				forgetCalendars(err)
+			}
+		}
+	}()
+}
+
+// checkCalendars warns about configured calendars which can't be found or
+// read, e.g. because they have been renamed or deleted. Reading them also
+// fills their copies
+func checkCalendars() {
+	now := time.Now()
+	for _, key := range []string{"calendars", "allday", "schedule.holidays"} {
+		if !viper.IsSet(key) {
+			continue
+		}
+		providers, err := calendarProviders(key)
+		if err != nil {
+			calendarLog.Warnf("Cannot check calendars in %s: %v", key, err)
+			forgetCalendars(err)
+			continue
+		}
+		for _, provider := range providers {
+			if _, err := provider.Items(now, now.Add(time.Minute)); err != nil {
+				calendarLog.Warnf("Cannot read calendar %s in %s: %v", provider.Name(), key, err)
+			}
+		}
+		calendarLog.Infof("%d calendars in %s", len(providers), key)
+	}
+}
+
+// syncCalendars updates the copies of the calendars
+func syncCalendars() error {
+	if _, _, err := calendarLists(); err != nil {
+		return err
+	}
+	calendarSets.Lock()
+	cache := calendarSets.cache
+	calendarSets.Unlock()
+	if cache != nil {
+		cache.Sync()
+	}
+	return nil
+}
+
+// newCalendarProviders creates the providers for the calendars listed under
+// the given key and tells whether all Google calendars have been found.
+// Google credentials are only needed if a Google calendar is listed.
+// Calendars are read from their copies in the cache
+func newCalendarProviders(key string, cache *calendar.Cache) ([]calendar.Provider, bool, error) {
+	entries, ok := viper.Get(key).([]interface{})
+	if !ok && viper.IsSet(key) {
+		return nil, false, configErrorf("%s must be a list of calendars", key)
+	}
+
+	configs := []calendarConfig{}
+	googleNames := []string{}
+	for _, entry := range entries {
+		config := calendarConfig{}
+		if name, ok := entry.(string); ok {
+			config.Name = name
+		} else if err := mapstructure.Decode(entry, &config); err != nil {
+			return nil, false, configErrorf("invalid calendar in %s: %v", key, err)
+		}
+		if config.Name == "" {
+			return nil, false, configErrorf("calendar without name in %s", key)
+		}
+		switch config.Type {
+		case "", "google":
+			googleNames = append(googleNames, config.Name)
+		case "caldav", "ics":
+			if config.URL == "" {
+				return nil, false, configErrorf("no url for calendar %s", config.Name)
+			}
+		default:
+			return nil, false, configErrorf("unknown type '%s' of calendar %s", config.Type, config.Name)
+		}
+		configs = append(configs, config)
+	}
+
+	google := map[string]calendar.Provider{}
+	if len(googleNames) > 0 {
+		tokens, err := googleTokens()
+		if err != nil {
+			return nil, false, err
+		}
+		if google, err = calendar.NewGoogleProviders(tokens, googleNames); err != nil {
+			return nil, false, err
+		}
+	}
+
+	providers := []calendar.Provider{}
+	complete := true
+	for _, config := range configs {
+		var provider calendar.Provider
+		switch config.Type {
+		case "caldav":
+			logging.Secret(config.Password)
+			provider = calendar.NewCalDAVProvider(config.Name, config.URL, config.User, config.Password)
+		case "ics":
+			provider = calendar.NewICSProvider(config.Name, config.URL)
+		default:
+			if provider = google[config.Name]; provider == nil {
+				// Already warned about when looking it up
+				complete = false
+				continue
+			}
+		}
+		if cache != nil {
+			provider = cache.Cached(provider)
+		}
+		filter, err := calendarFilter(config)
+		if err != nil {
+			return nil, false, err
+		}
+		providers = append(providers, calendar.Filtered(provider, filter))
+	}
+	return providers, complete, nil
+}
+
+// calendarFilter creates the filter for the events of a calendar
+func calendarFilter(config calendarConfig) (calendar.Filter, error) {
+	filter := calendar.Filter{
+		Alias:        config.Alias,
+		ShowDeclined: config.ShowDeclined,
+		ShowFree:     config.ShowFree,
+		Private:      config.Private,
+	}
+	switch config.Private {
+	case "", calendar.PrivateMask, calendar.PrivateHide, calendar.PrivateShow:
+	default:
+		return filter, configErrorf("invalid value '%s' for private of calendar %s", config.Private, config.Name)
+	}
+	var err error
+	if filter.Include, err = compilePatterns(config.Include); err != nil {
+		return filter, configErrorf("invalid include of calendar %s: %v", config.Name, err)
+	}
+	if filter.Exclude, err = compilePatterns(config.Exclude); err != nil {
+		return filter, configErrorf("invalid exclude of calendar %s: %v", config.Name, err)
+	}
+	return filter, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	ret := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+// authorizeCalendar runs the authorization flow and stores the token
+func authorizeCalendar() error {
+	if viper.GetString("google.service_account") != "" {
+		return configErrorf("No authorization needed, a service account is configured")
+	}
+	jsonKey, err := googleClientSecret()
+	if err != nil {
+		return err
+	}
+	token, err := calendar.LoopbackAuth(jsonKey, calendarAuthPort, func(authURL string) {
+		fmt.Printf("Open the following link in your browser:\n\n  %s\n\n", authURL)
+	})
+	if err != nil {
+		return err
+	}
+	if err := saveToken(calendarTokenFile(), token); err != nil {
+		return err
+	}
+	fmt.Println("Calendar access authorized")
+	return nil
+}
+
+// googleTokens returns the source of tokens for the Google calendars. These
+// are issued for the service account if configured, else for the authorized
+// user with refreshed tokens being stored
+func googleTokens() (oauth2.TokenSource, error) {
+	if serviceAccount := viper.GetString("google.service_account"); serviceAccount != "" {
+		if !filepath.IsAbs(serviceAccount) {
+			serviceAccount = filepath.Join(viper.GetString("configdir"), serviceAccount)
+		}
+		jsonKey, err := ioutil.ReadFile(serviceAccount)
+		if err != nil {
+			return nil, configErrorf("Unable to read service account key: %v", err)
+		}
+		tokens, err := calendar.ServiceAccountTokens(jsonKey, viper.GetString("google.subject"))
+		return tokens, asConfigError(err)
+	}
+
+	jsonKey, err := googleClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	tokenFile := calendarTokenFile()
+	token, err := tokenFromFile(tokenFile)
+	if err != nil {
+		return nil, failure.New(calendar.ErrReauthorize,
+			fmt.Errorf("no token in %s, run 'puffer calendar auth': %v", tokenFile, err))
+	}
+	return calendar.TokenSource(jsonKey, token, func(token *oauth2.Token) error {
+		return saveToken(tokenFile, token)
+	})
+}
+
+func googleClientSecret() ([]byte, error) {
+	jsonKey, err := ioutil.ReadFile(filepath.Join(viper.GetString("configdir"), "google-client-secret.json"))
+	if err != nil {
+		return nil, configErrorf("Unable to read client secret file: %v", err)
+	}
+	return jsonKey, nil
+}
+
+func calendarTokenFile() string {
+	return filepath.Join(viper.GetString("configdir"), "calendar-token.json")
+}
+
+// eventSummary returns the summary to announce, which is a general one in
+// the language of the answer for masked private events
+func eventSummary(event calendar.Event, lang string) string {
+	if event.Masked {
+		return Texts["cal-private"][lang]
+	}
+	return event.Summary
+}
+
+func getEventMessage(event calendar.TimedEvent, lang string, details *eventDetails) string {
+	summary := eventSummary(event.Event, lang)
+	location := spokenLocation(event.Location)
+	if details.location && location != "" {
+		summary += fmt.Sprintf(Texts["cal-location"][lang], location)
+	}
+	if details.attendees && len(event.Attendees) > 0 {
+		summary += fmt.Sprintf(Texts["cal-attendees"][lang], attendeesText(event.Attendees, lang))
+	}
+	if travel, found := details.travelTime(event.Location); found {
+		summary += fmt.Sprintf(Texts["cal-leave-by"][lang], clockText(event.Start.Add(-travel), lang))
+	}
+
+	var text string
+	min := event.Start.Minute()
+	if min == 0 {
+		text = fmt.Sprintf(Texts["cal-timed-event"][lang],
+			event.Calendar, event.Start.Hour(), summary)
+	} else {
+		text = fmt.Sprintf(Texts["cal-timed-event-with-minute"][lang],
+			event.Calendar, event.Start.Hour(), min, summary)
+	}
+	return text
+}
+
+// eventDetails tells which details are announced with timed events
+type eventDetails struct {
+	location  bool
+	attendees bool
+	// Travel times by lower case keywords of locations
+	travel map[string]time.Duration
+}
+
+// Most attendees to name
+const maxAttendees = 3
+
+// loadEventDetails reads the "event_details" section of the configuration
+func loadEventDetails() (*eventDetails, error) {
+	details := &eventDetails{
+		location:  viper.GetBool("event_details.location"),
+		attendees: viper.GetBool("event_details.attendees"),
+		travel:    map[string]time.Duration{},
+	}
+	for keyword, value := range viper.GetStringMapString("event_details.travel") {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, configErrorf("invalid travel time for %s: %v", keyword, err)
+		}
+		details.travel[strings.ToLower(keyword)] = d
+	}
+	return details, nil
+}
+
+// travelTime looks up the travel time to a location. The longest keyword
+// contained in the location wins, "default" is used for any other location
+func (d *eventDetails) travelTime(location string) (time.Duration, bool) {
+	if location == "" {
+		return 0, false
+	}
+	location = strings.ToLower(location)
+	best := ""
+	for keyword := range d.travel {
+		if keyword != "default" && strings.Contains(location, keyword) && len(keyword) > len(best) {
+			best = keyword
+		}
+	}
+	if best == "" {
+		best = "default"
+	}
+	travel, found := d.travel[best]
+	return travel, found
+}
+
+// spokenLocation shortens an address like "Hauptstraße 1, 80331 München"
+// to its first part
+func spokenLocation(location string) string {
+	return strings.TrimSpace(strings.SplitN(location, ",", 2)[0])
+}
+
+// attendeesText names the first attendees and counts the others. Of email
+// addresses only the part before the @ is spoken
+func attendeesText(attendees []string, lang string) string {
+	names := []string{}
+	for _, attendee := range attendees {
+		names = append(names, strings.SplitN(attendee, "@", 2)[0])
+	}
+	if len(names) <= maxAttendees {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf(Texts["cal-more-attendees"][lang],
+		strings.Join(names[:maxAttendees], ", "), len(names)-maxAttendees)
+}
+
+// reminderEvents fetches the timed events of the "calendars" to remind of
+func reminderEvents(start time.Time, end time.Time) ([]calendar.TimedEvent, error) {
+	providers, err := calendarProviders("calendars")
+	if err != nil {
+		return nil, err
+	}
+	events, err := calendar.GetTimedEvents(providers, start, end)
+	forgetCalendars(err)
+	return events, err
+}
+
+// reminderText announces that an event starts soon
+func reminderText(event calendar.TimedEvent, until time.Duration) string {
+	details, err := loadEventDetails()
+	if err != nil {
+		calendarLog.Warnf("%v", err)
+		details = &eventDetails{}
+	}
+	return reminderMessage(event, until, language, details)
+}
+
+// reminderMessage announces an event starting after until. Leads of less
+// than an hour are spoken in minutes, those on the same day in hours and
+// later ones by the day, as the time follows with the event
+func reminderMessage(event calendar.TimedEvent, until time.Duration, lang string, details *eventDetails) string {
+	start := event.Start.In(time.Local)
+	year, month, day := start.Add(-until).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+	var prefix string
+	switch hours := int((until + 30*time.Minute) / time.Hour); {
+	case until < time.Minute:
+		prefix = Texts["cal-reminder-now"][lang]
+	case until < time.Hour:
+		prefix = fmt.Sprintf(Texts["cal-reminder-minutes"][lang], int(until.Minutes()))
+	case startDay.Equal(today) && hours == 1:
+		prefix = Texts["cal-reminder-hour"][lang]
+	case startDay.Equal(today):
+		prefix = fmt.Sprintf(Texts["cal-reminder-hours"][lang], hours)
+	case startDay.Equal(today.AddDate(0, 0, 1)):
+		prefix = Texts["cal-reminder-tomorrow"][lang]
+	default:
+		prefix = fmt.Sprintf(Texts["cal-reminder-day"][lang], fmt.Sprintf(Texts["cal-date"][lang],
+			weekdayNames[lang][startDay.Weekday()], startDay.Day(), monthNames[lang][startDay.Month()-1]))
+	}
+	return prefix + " " + getEventMessage(event, lang, details)
+}
+
+// getAllDayMessage announces an all-day event, telling which day it is
+// for events lasting several days
+func getAllDayMessage(event calendar.Event, lang string) string {
+	return fmt.Sprintf(Texts["cal-event-no-time"][lang], eventSummary(event, lang)+daySpanText(event, lang))
+}
+
+// getOngoingMessage announces an event which is still running
+func getOngoingMessage(event calendar.TimedEvent, lang string) string {
+	year, month, day := time.Now().Date()
+	end := event.End.In(time.Local)
+	until := clockText(end, lang)
+	if y, m, d := end.Date(); y != year || m != month || d != day {
+		until = fmt.Sprintf(Texts["cal-at-day"][lang], weekdayNames[lang][end.Weekday()], until)
+	}
+	return fmt.Sprintf(Texts["cal-ongoing"][lang], event.Calendar, until, eventSummary(event.Event, lang)+daySpanText(event.Event, lang))
+}
+
+// daySpanText tells which day of an event lasting several days it is
+func daySpanText(event calendar.Event, lang string) string {
+	if event.Days == 0 {
+		return ""
+	}
+	return fmt.Sprintf(Texts["cal-day-of"][lang], event.Day, event.Days)
+}
+
+// clockText speaks the time of day
+func clockText(t time.Time, lang string) string {
+	if t.Minute() == 0 {
+		return fmt.Sprintf(Texts["cal-clock"][lang], t.Hour())
+	}
+	return fmt.Sprintf(Texts["cal-clock-with-minute"][lang], t.Hour(), t.Minute())
+}
+
+// tokenFromFile retrieves a Token from a given file path.
+// It returns the retrieved Token and any read error encountered.
+func tokenFromFile(file string) (*oauth2.Token, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	t := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(t)
+	defer f.Close()
+	return t, err
+}
+
+// saveToken uses a file path to create a file and store the
+// token in it. The file is only readable by the owner
+func saveToken(file string, token *oauth2.Token) error {
+	calendarLog.Infof("Saving credential file to: %s", file)
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to cache oauth token: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(token)
+}
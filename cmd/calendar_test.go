@@ -0,0 +1,154 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+)
+
+// staticCalendar is a calendar with fixed events
+type staticCalendar []calendar.Item
+
+func (c staticCalendar) Name() string {
+	return "Familie"
+}
+
+func (c staticCalendar) Items(start time.Time, end time.Time) ([]calendar.Item, error) {
+	return c, nil
+}
+
+func TestPrivateEventsInLanguageOfAnswer(t *testing.T) {
+	start := time.Date(2017, 3, 8, 9, 0, 0, 0, time.Local)
+	day := time.Date(2017, 3, 8, 0, 0, 0, 0, time.Local)
+	filter, err := calendarFilter(calendarConfig{Name: "family"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := calendar.Filtered(staticCalendar{
+		{Summary: "Zahnarzt", Start: start, End: start.Add(time.Hour), Private: true, Location: "Hauptstraße 1"},
+		{Summary: "Urlaub", Start: day, End: day.AddDate(0, 0, 1), AllDay: true, Private: true},
+	}, filter)
+	days, err := calendar.GetEvents([]calendar.Provider{provider}, nil, calendar.Window{Start: day, End: day.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || len(days[0].Timed) != 1 || len(days[0].AllDay) != 1 {
+		t.Fatalf("unexpected events %+v", days)
+	}
+
+	details := &eventDetails{location: true}
+	for _, c := range []struct {
+		lang   string
+		timed  string
+		allDay string
+	}{
+		{"de", "Familie - 9 Uhr : Privater Termin", "Privater Termin."},
+		{"en", "Familie - 9 o'clock : Private appointment", "Private appointment."},
+	} {
+		if msg := getEventMessage(days[0].Timed[0], c.lang, details); msg != c.timed {
+			t.Errorf("expected %q, got %q", c.timed, msg)
+		}
+		if msg := getAllDayMessage(days[0].AllDay[0], c.lang); msg != c.allDay {
+			t.Errorf("expected %q, got %q", c.allDay, msg)
+		}
+	}
+}
+
+func TestEventMessageInLocalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	local := time.Local
+	time.Local = berlin
+	defer func() { time.Local = local }()
+
+	// Events in UTC, as received from Google
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2017, 3, 8, hour, minute, 0, 0, time.UTC)
+	}
+	provider := staticCalendar{
+		{Summary: "Zahnarzt", Start: at(8, 30), End: at(9, 30), Location: "Hauptstraße 1, Berlin", Attendees: []string{"Roland", "dr.zahn@example.com"}},
+		{Summary: "Elternabend", Start: at(17, 0), End: at(19, 0), Location: "Schule",
+			Attendees: []string{"Roland", "Anna", "Frau Meier", "Herr Schulz", "kasse@schule.de"}},
+		{Summary: "Telefonat", Start: at(11, 0), End: at(11, 30)},
+	}
+	events, err := calendar.GetTimedEvents([]calendar.Provider{provider}, at(0, 0), at(23, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	travel := map[string]time.Duration{"hauptstraße": 20 * time.Minute, "default": 45 * time.Minute}
+	for _, c := range []struct {
+		lang     string
+		details  eventDetails
+		expected []string
+	}{
+		{"de", eventDetails{location: true, attendees: true, travel: travel}, []string{
+			"Familie - 9 Uhr 30 : Zahnarzt, Ort: Hauptstraße 1, mit Roland, dr.zahn, losfahren um 9 Uhr 10",
+			"Familie - 12 Uhr : Telefonat",
+			"Familie - 18 Uhr : Elternabend, Ort: Schule, mit Roland, Anna, Frau Meier und 2 weiteren, losfahren um 17 Uhr 15",
+		}},
+		{"en", eventDetails{location: true, attendees: true, travel: travel}, []string{
+			"Familie - 9 30 : Zahnarzt, at Hauptstraße 1, with Roland, dr.zahn, leave by 9 10",
+			"Familie - 12 o'clock : Telefonat",
+			"Familie - 18 o'clock : Elternabend, at Schule, with Roland, Anna, Frau Meier and 2 more, leave by 17 15",
+		}},
+		{"de", eventDetails{}, []string{
+			"Familie - 9 Uhr 30 : Zahnarzt",
+			"Familie - 12 Uhr : Telefonat",
+			"Familie - 18 Uhr : Elternabend",
+		}},
+	} {
+		for i, event := range events {
+			details := c.details
+			if msg := getEventMessage(event, c.lang, &details); msg != c.expected[i] {
+				t.Errorf("expected %q, got %q", c.expected[i], msg)
+			}
+		}
+	}
+}
+
+func TestReminderMessage(t *testing.T) {
+	// Wednesday
+	now := time.Date(2017, 3, 8, 8, 0, 0, 0, time.Local)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2017, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	for _, c := range []struct {
+		start    time.Time
+		lang     string
+		expected string
+	}{
+		{at(8, 8, 0), "de", "Erinnerung, jetzt : Familie - 8 Uhr : Zahnarzt"},
+		{at(8, 8, 30), "de", "Erinnerung, in 30 Minuten : Familie - 8 Uhr 30 : Zahnarzt"},
+		{at(8, 9, 0), "de", "Erinnerung, in einer Stunde : Familie - 9 Uhr : Zahnarzt"},
+		{at(8, 10, 30), "de", "Erinnerung, in 3 Stunden : Familie - 10 Uhr 30 : Zahnarzt"},
+		{at(8, 10, 30), "en", "Reminder, in 3 hours : Familie - 10 30 : Zahnarzt"},
+		{at(9, 7, 0), "de", "Erinnerung für morgen : Familie - 7 Uhr : Zahnarzt"},
+		{at(9, 9, 0), "en", "Reminder for tomorrow : Familie - 9 o'clock : Zahnarzt"},
+		{at(10, 9, 0), "de", "Erinnerung für Freitag, 10. März : Familie - 9 Uhr : Zahnarzt"},
+		{at(10, 9, 0), "en", "Reminder for Friday, March 10 : Familie - 9 o'clock : Zahnarzt"},
+	} {
+		start, end := c.start, c.start.Add(time.Hour)
+		event := calendar.TimedEvent{Start: &start, End: &end, Event: calendar.Event{Calendar: "Familie", Summary: "Zahnarzt"}}
+		if msg := reminderMessage(event, start.Sub(now), c.lang, &eventDetails{}); msg != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, msg)
+		}
+	}
+}
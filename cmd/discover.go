@@ -0,0 +1,225 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/rhuss/puffer/pkg/button"
+	"github.com/rhuss/puffer/pkg/trigger"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// discoverButtons reports devices sending packets like a button and saves
+// them under a name in the "buttons" section of the configuration file
+// when confirmed
+func discoverButtons() error {
+	ifaces, err := watchInterfaces()
+	if err != nil {
+		return err
+	}
+	devices := make(chan button.Device)
+	discoverer := button.NewDiscoverer(knownButtons())
+	for _, iface := range ifaces {
+		if err := discoverer.Discover(iface, devices); err != nil {
+			return err
+		}
+	}
+
+	file := viper.ConfigFileUsed()
+	saveable := isYAMLFile(file)
+	if !saveable {
+		fmt.Printf("Buttons can only be saved in YAML configuration files, add them to the \"buttons\" section of %s yourself\n", file)
+	}
+	fmt.Println("Listening for buttons, press the button now (Ctrl-C to quit)")
+	in := bufio.NewReader(os.Stdin)
+	for device := range devices {
+		vendor := device.Vendor
+		if vendor == "" {
+			vendor = "unknown vendor"
+		}
+		fmt.Printf("\nFound %s (%s) by %s at %s\n", device.MAC, vendor, device.Kind, device.Time.Format("15:04:05"))
+		if !saveable {
+			continue
+		}
+		fmt.Print("Name for this button (empty to skip): ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		if err := saveButton(file, name, device.MAC.String()); err != nil {
+			return err
+		}
+		fmt.Printf("Saved %s as button %s in %s\n", device.MAC, name, file)
+	}
+	return nil
+}
+
+// knownButtons returns the MAC addresses of all configured buttons
+func knownButtons() []net.HardwareAddr {
+	macs := []string{}
+	for _, mac := range viper.GetStringMapString("buttons") {
+		macs = append(macs, mac)
+	}
+	var configs []trigger.Config
+	if err := unmarshalKey("triggers", &configs); err == nil {
+		for _, t := range configs {
+			macs = append(macs, t.Mac)
+		}
+	}
+
+	known := []net.HardwareAddr{}
+	for _, mac := range macs {
+		if hw, err := net.ParseMAC(mac); err == nil {
+			known = append(known, hw)
+		}
+	}
+	return known
+}
+
+// saveButton sets "buttons.<name>" in a YAML configuration file. The line of
+// the button is edited in place, so that comments and formatting are kept.
+// If that's not possible, e.g. for a "buttons" section in flow style, the
+// whole file is rewritten without comments after saving a backup
+func saveButton(file, name, mac string) error {
+	if !isYAMLFile(file) {
+		return fmt.Errorf("cannot save buttons in %s, only YAML configuration files are supported", file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	config := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("cannot parse %s: %v", file, err)
+	}
+	config = setMapItem(config, "buttons", func(value interface{}) interface{} {
+		buttons, _ := value.(yaml.MapSlice)
+		return setMapItem(buttons, name, func(interface{}) interface{} { return mac })
+	})
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	edited, err := setButtonLine(data, name, mac)
+	if err == nil {
+		// Only use the edited file if it means the same as the rewritten one
+		parsed := yaml.MapSlice{}
+		if yaml.Unmarshal(edited, &parsed) == nil && reflect.DeepEqual(parsed, config) {
+			return ioutil.WriteFile(file, edited, info.Mode())
+		}
+	}
+
+	backup := file + ".bak"
+	if err := ioutil.WriteFile(backup, data, info.Mode()); err != nil {
+		return fmt.Errorf("cannot save backup of %s: %v", file, err)
+	}
+	data, err = yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	watchLog.Warnf("Rewrote %s without its comments, the original is saved as %s", file, backup)
+	return ioutil.WriteFile(file, data, info.Mode())
+}
+
+// isYAMLFile checks whether a configuration file is in YAML by its extension
+func isYAMLFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// Start of the top level "buttons" section in block style
+var buttonsSection = regexp.MustCompile(`^buttons:\s*(#.*)?$`)
+
+// setButtonLine sets the entry of a button in the "buttons" section of a YAML
+// document by editing its lines. The section is added at the end if missing.
+// An error is returned if the section isn't in the block style
+func setButtonLine(data []byte, name, mac string) ([]byte, error) {
+	entry, err := yaml.Marshal(yaml.MapSlice{{Key: name, Value: mac}})
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.SplitAfter(text, "\n")
+	lines = lines[:len(lines)-1]
+
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "buttons:") {
+			if !buttonsSection.MatchString(strings.TrimRight(line, "\r\n")) {
+				return nil, fmt.Errorf("buttons section is not in block style")
+			}
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return []byte(text + "buttons:\n  " + string(entry)), nil
+	}
+
+	// The section ends with the first line which isn't indented
+	indent, last := "  ", start
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		content := strings.TrimSpace(line)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			break
+		}
+		if last == start {
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+		last = i
+		item := yaml.MapSlice{}
+		if strings.HasPrefix(line, indent) && strings.TrimLeft(line, " \t") == line[len(indent):] && yaml.Unmarshal([]byte(content), &item) == nil &&
+			len(item) == 1 && fmt.Sprint(item[0].Key) == name {
+			lines[i] = indent + string(entry)
+			return []byte(strings.Join(lines, "")), nil
+		}
+	}
+	lines = append(lines[:last+1], append([]string{indent + string(entry)}, lines[last+1:]...)...)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// setMapItem replaces the value of a key with the result of update, which
+// gets the old value or nil if the key doesn't exist yet
+func setMapItem(items yaml.MapSlice, key string, update func(interface{}) interface{}) yaml.MapSlice {
+	for i := range items {
+		if items[i].Key == key {
+			items[i].Value = update(items[i].Value)
+			return items
+		}
+	}
+	return append(items, yaml.MapItem{Key: key, Value: update(nil)})
+}
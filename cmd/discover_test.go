@@ -0,0 +1,123 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveTestButton saves a button in a configuration file with the given
+// content and returns the content afterwards
+func saveTestButton(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveButton(file, "kitchen", "68:37:e9:11:22:33"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSaveButtonKeepsComments(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			"new button",
+			"# Puffer\nlanguage: de\nbuttons:\n    # Hallway\n    puffer: 50:f5:da:44:55:66\n\n# Speech\nbackend: polly\n",
+			"# Puffer\nlanguage: de\nbuttons:\n    # Hallway\n    puffer: 50:f5:da:44:55:66\n    kitchen: 68:37:e9:11:22:33\n\n# Speech\nbackend: polly\n",
+		},
+		{
+			"replaced button",
+			"buttons: # by name\n  kitchen: 50:f5:da:44:55:66 # old one\n  puffer: 44:65:0d:aa:bb:cc\n",
+			"buttons: # by name\n  kitchen: 68:37:e9:11:22:33\n  puffer: 44:65:0d:aa:bb:cc\n",
+		},
+		{
+			"new section",
+			"# Puffer\nlanguage: de",
+			"# Puffer\nlanguage: de\nbuttons:\n  kitchen: 68:37:e9:11:22:33\n",
+		},
+		{
+			"empty section",
+			"buttons:\n# Speech\nbackend: polly\n",
+			"buttons:\n  kitchen: 68:37:e9:11:22:33\n# Speech\nbackend: polly\n",
+		},
+	} {
+		if content := saveTestButton(t, "config.yml", c.config); content != c.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", c.name, c.expected, content)
+		}
+	}
+}
+
+func TestSaveButtonRewritesFlowStyle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	original := "# Puffer\nbuttons: {puffer: \"50:f5:da:44:55:66\"}\n"
+	if err := ioutil.WriteFile(file, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveButton(file, "kitchen", "68:37:e9:11:22:33"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(file)
+	expected := "buttons:\n  puffer: 50:f5:da:44:55:66\n  kitchen: 68:37:e9:11:22:33\n"
+	if string(data) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, data)
+	}
+	backup, err := ioutil.ReadFile(file + ".bak")
+	if err != nil || string(backup) != original {
+		t.Errorf("no backup of the original: %s %v", backup, err)
+	}
+}
+
+func TestSaveButtonRefusesOtherFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"config.json", "config.toml"} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveButton(file, "kitchen", "68:37:e9:11:22:33"); err == nil {
+			t.Errorf("saved button in %s", name)
+		}
+		if data, _ := ioutil.ReadFile(file); string(data) != "{}" {
+			t.Errorf("%s changed to %s", name, data)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/speak"
+	"github.com/rhuss/puffer/pkg/trigger"
+)
+
+// Window for double presses if not configured for a button
+const defaultPressWindow = 8 * time.Second
+
+// Actions which don't speak and are run right away instead of
+// waiting for the current announcement to finish
+var inlineActions = map[string]bool{
+	"stop": true,
+	"dnd":  true,
+}
+
+// dispatcher runs the actions of fired triggers. Actions are run one after
+// the other in the background, so that button presses can be recognized
+// while an announcement is still playing
+type dispatcher struct {
+	triggers  map[string]*trigger.Config
+	actions   map[string]action
+	scheduler *scheduler
+
+	// press pattern recognition for button triggers and the event of the
+	// press waiting for a second one
+	classifiers map[string]*trigger.Classifier
+	pending     map[string]trigger.Event
+
+	// Replayed events are handled one after the other in the time of
+	// the events, so that the outcome doesn't depend on timing
+	replay bool
+
+	jobs  chan func()
+	done  chan struct{}
+	mutex sync.Mutex
+	busy  bool
+}
+
+func newDispatcher(triggers map[string]*trigger.Config, actions map[string]action, scheduler *scheduler) *dispatcher {
+	d := &dispatcher{
+		triggers:    triggers,
+		actions:     actions,
+		scheduler:   scheduler,
+		classifiers: map[string]*trigger.Classifier{},
+		pending:     map[string]trigger.Event{},
+		jobs:        make(chan func(), 16),
+		done:        make(chan struct{}),
+	}
+	for name, t := range triggers {
+		if t.Type != "button" {
+			continue
+		}
+		classifier := &trigger.Classifier{}
+		if t.Double != "" {
+			classifier.Window = t.Window
+			if classifier.Window == 0 {
+				classifier.Window = defaultPressWindow
+			}
+		}
+		d.classifiers[name] = classifier
+	}
+	return d
+}
+
+// run dispatches events until the channel is closed and all actions have
+// finished. Queued announcements are delivered in between so that nothing
+// is spoken at the same time
+func (d *dispatcher) run(events <-chan trigger.Event) {
+	go d.work()
+	defer func() {
+		close(d.jobs)
+		<-d.done
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	lastDelivery := time.Now()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if d.replay {
+					// All pending presses are single ones now
+					d.expire(time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+				}
+				return
+			}
+			if d.replay {
+				d.expire(event.Time)
+			}
+			d.handle(event)
+		case now := <-ticker.C:
+			if !d.replay {
+				d.expire(now)
+			}
+			if now.Sub(lastDelivery) >= time.Minute {
+				lastDelivery = now
+				d.jobs <- deliverQueued
+			}
+		}
+	}
+}
+
+// expire runs the actions of pending presses whose window is over
+func (d *dispatcher) expire(now time.Time) {
+	expired := []string{}
+	for name, classifier := range d.classifiers {
+		if classifier.Expire(now) == trigger.PressSingle {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	for _, name := range expired {
+		d.runAction(d.triggers[name].Action, d.pending[name])
+		delete(d.pending, name)
+	}
+}
+
+func (d *dispatcher) handle(event trigger.Event) {
+	t := d.triggers[event.Trigger]
+	if t.Type == "cron" || t.Type == "reminder" {
+		// Reminders may be fired late, e.g. after a restart
+		at := event.Time
+		if t.Type == "reminder" {
+			at = time.Now()
+		}
+		if reason := d.scheduler.skipReason(t, at); reason != "" {
+			watchLog.Infof("Skipping scheduled trigger %s: %s", t.Name, reason)
+			return
+		}
+	}
+
+	classifier, found := d.classifiers[t.Name]
+	if !found {
+		d.runAction(t.Action, event)
+		return
+	}
+	switch pattern := classifier.Press(event.Time, d.isBusy()); pattern {
+	case trigger.PressSingle:
+		if !classifier.Pending() {
+			d.runAction(t.Action, event)
+			break
+		}
+		// The earlier press hasn't expired in time, this one is pending now
+		d.runAction(t.Action, d.pending[t.Name])
+		d.pending[t.Name] = event
+	case trigger.PressDouble:
+		watchLog.Infof("Double press of %s", t.Name)
+		delete(d.pending, t.Name)
+		d.runAction(t.Double, event)
+	case trigger.PressStop:
+		watchLog.Infof("Press of %s while playing", t.Name)
+		delete(d.pending, t.Name)
+		stop := t.Stop
+		if stop == "" {
+			stop = "stop"
+		}
+		d.runAction(stop, event)
+	default:
+		d.pending[t.Name] = event
+	}
+}
+
+// runAction runs an action for an event, either right away or in the background
+func (d *dispatcher) runAction(name string, event trigger.Event) {
+	job := func() {
+		watchLog.Infof("Trigger %s fired, running action %s", event.Trigger, name)
+		err := d.actions[name](event)
+		if err == speak.ErrInterrupted {
+			watchLog.Infof("Action %s interrupted", name)
+		} else if err != nil {
+			watchLog.Errorf("Action %s failed: %v", name, err)
+		}
+	}
+	if inlineActions[name] {
+		job()
+		return
+	}
+	if d.replay {
+		finished := make(chan struct{})
+		d.jobs <- func() {
+			job()
+			close(finished)
+		}
+		<-finished
+		return
+	}
+	d.jobs <- job
+}
+
+// work runs the jobs one after the other
+func (d *dispatcher) work() {
+	for job := range d.jobs {
+		d.setBusy(true)
+		speak.Resume()
+		job()
+		d.setBusy(false)
+	}
+	close(d.done)
+}
+
+func (d *dispatcher) isBusy() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.busy
+}
+
+func (d *dispatcher) setBusy(busy bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.busy = busy
+}
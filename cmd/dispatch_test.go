@@ -0,0 +1,54 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/trigger"
+)
+
+func TestDispatchLatePress(t *testing.T) {
+	fired := []string{}
+	record := func(name string) action {
+		return func(event trigger.Event) error {
+			fired = append(fired, name+" "+event.Payload)
+			return nil
+		}
+	}
+	d := newDispatcher(
+		map[string]*trigger.Config{"kitchen": {Name: "kitchen", Type: "button", Action: "single", Double: "double", Window: 8 * time.Second}},
+		map[string]action{"single": record("single"), "double": record("double")},
+		&scheduler{})
+
+	start := time.Date(2017, 3, 1, 8, 0, 0, 0, time.UTC)
+	// The first press isn't expired before the second one arrives
+	for i, offset := range []time.Duration{0, 10 * time.Second, 12 * time.Second, 30 * time.Second} {
+		d.handle(trigger.Event{Trigger: "kitchen", Time: start.Add(offset), Payload: strconv.Itoa(i + 1)})
+	}
+	d.expire(start.Add(time.Minute))
+	close(d.jobs)
+	for job := range d.jobs {
+		job()
+	}
+
+	expected := []string{"single 1", "double 3", "single 4"}
+	if !reflect.DeepEqual(fired, expected) {
+		t.Errorf("expected %v, got %v", expected, fired)
+	}
+}
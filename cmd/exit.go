@@ -0,0 +1,82 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/puffer"
+	"github.com/rhuss/puffer/pkg/speak"
+)
+
+// Exit codes as documented in the help of the root command
+const (
+	exitError       = 1
+	exitConfig      = 2
+	exitAuth        = 3
+	exitNoData      = 4
+	exitUnavailable = 5
+)
+
+// configError is an invalid command line or configuration
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+// configErrorf creates a configError like fmt.Errorf
+func configErrorf(format string, args ...interface{}) error {
+	return &configError{fmt.Errorf(format, args...)}
+}
+
+// asConfigError marks an error as configuration error
+func asConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &configError{err}
+}
+
+// exitCode maps an error to the exit code of the command. Wrapped errors
+// are followed until their kind is found
+func exitCode(err error) int {
+	for err != nil {
+		if _, ok := err.(*configError); ok {
+			return exitConfig
+		}
+		switch err {
+		case speak.ErrConfig:
+			return exitConfig
+		case puffer.ErrAuth, speak.ErrAuth, calendar.ErrAuth, calendar.ErrReauthorize:
+			return exitAuth
+		case puffer.ErrNoData, calendar.ErrNoData:
+			return exitNoData
+		case puffer.ErrBackendUnavailable, speak.ErrBackendUnavailable, calendar.ErrBackendUnavailable:
+			return exitUnavailable
+		}
+		c, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return exitError
+		}
+		err = c.Cause()
+	}
+	return exitError
+}
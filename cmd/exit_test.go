@@ -0,0 +1,49 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/puffer"
+	"github.com/rhuss/puffer/pkg/speak"
+)
+
+func TestExitCode(t *testing.T) {
+	cause := errors.New("connection refused")
+	for _, c := range []struct {
+		err  error
+		code int
+	}{
+		{errors.New("failed"), exitError},
+		{configErrorf("invalid"), exitConfig},
+		{speak.Speak("text", &speak.Options{Backend: "unknown"}), exitConfig},
+		{failure.New(puffer.ErrAuth, cause), exitAuth},
+		{failure.New(calendar.ErrReauthorize, cause), exitAuth},
+		{failure.New(calendar.ErrNoData, cause), exitNoData},
+		{failure.New(speak.ErrBackendUnavailable, cause), exitUnavailable},
+		{failure.Wrapf(failure.New(puffer.ErrNoData, cause), "cannot announce"), exitNoData},
+		{failure.Wrapf(failure.Wrapf(failure.New(calendar.ErrBackendUnavailable, cause), "calendar"), "action"), exitUnavailable},
+		{failure.Wrapf(configErrorf("invalid"), "cannot start"), exitConfig},
+		{asConfigError(failure.New(calendar.ErrAuth, cause)), exitConfig},
+	} {
+		if code := exitCode(c.err); code != c.code {
+			t.Errorf("%v: expected exit code %d, got %d", c.err, c.code, code)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+)
+
+// intentHandler creates the answer for an intent in the given language.
+// when is the time range asked for (see calendar.ParseWindow) or empty
+type intentHandler func(lang string, when string) (string, error)
+
+// Intents known to all conversational frontends. The default intent
+// is used when a request doesn't ask for anything specific
+var intentHandlers = map[string]intentHandler{
+	"puffer": func(lang string, when string) (string, error) {
+		return getPufferSummaryMessage(lang)
+	},
+	"calendar": getCalendarSummaryMessage,
+}
+
+const defaultIntent = "puffer"
+
+// IntentPhrases are the keywords per language used for matching free text
+// to an intent
+var IntentPhrases = map[string]map[string][]string{
+	"puffer": {
+		"de": {"puffer", "speicher", "temperatur", "warm", "heiß", "wasser"},
+		"en": {"puffer", "storage", "tank", "temperature", "warm", "hot", "water"},
+	},
+	"calendar": {
+		"de": {"termin", "kalender", "heute", "morgen", "vorhaben", "woche",
+			"montag", "dienstag", "mittwoch", "donnerstag", "freitag", "samstag", "sonntag"},
+		"en": {"calendar", "event", "appointment", "today", "tomorrow", "schedule", "agenda", "week",
+			"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"},
+	},
+}
+
+// WindowPhrases map phrases per language to the time ranges they ask for.
+// The longest phrase contained in a text wins
+var WindowPhrases = map[string]map[string]string{
+	"de": {
+		"heute": "today", "heute morgen": "today", "morgen": "tomorrow",
+		"woche": "week", "diese woche": "week", "wochenende": "weekend",
+		"nächste woche": "next-week", "nächsten woche": "next-week",
+		"montag": "monday", "dienstag": "tuesday", "mittwoch": "wednesday", "donnerstag": "thursday",
+		"freitag": "friday", "samstag": "saturday", "sonntag": "sunday",
+	},
+	"en": {
+		"today": "today", "tomorrow": "tomorrow",
+		"week": "week", "this week": "week", "next week": "next-week", "weekend": "weekend",
+		"monday": "monday", "tuesday": "tuesday", "wednesday": "wednesday", "thursday": "thursday",
+		"friday": "friday", "saturday": "saturday", "sunday": "sunday",
+	},
+}
+
+// resolveIntent maps an intent name as given by an assistant like
+// "CalendarIntent" to the name of a handler. The empty string is returned
+// if there is no such handler
+func resolveIntent(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), "intent")
+	if _, found := intentHandlers[name]; found {
+		return name
+	}
+	return ""
+}
+
+// matchIntent finds the intent for a free text in the given language by
+// counting the words starting with a keyword of each intent. Of intents
+// with the same count the one with the longer keywords wins, as these are
+// more specific. The empty string is returned if no keyword matches at all
+// or the intents still tie
+func matchIntent(text string, lang string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r == '-' || r == 'ß' || r >= 'a' && r <= 'z' || r >= 'à' && r <= 'ÿ')
+	})
+	best, bestScore, bestLength, tied := "", 0, 0, false
+	for intent, phrases := range IntentPhrases {
+		score, length := 0, 0
+		for _, word := range words {
+			matched := 0
+			for _, phrase := range phrases[lang] {
+				if strings.HasPrefix(word, phrase) && len(phrase) > matched {
+					matched = len(phrase)
+				}
+			}
+			if matched > 0 {
+				score++
+				length += matched
+			}
+		}
+		switch {
+		case score == 0:
+		case score > bestScore || score == bestScore && length > bestLength:
+			best, bestScore, bestLength, tied = intent, score, length, false
+		case score == bestScore && length == bestLength:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// matchWindow finds the time range asked for in a free text. The empty
+// string is returned if the text doesn't mention any
+func matchWindow(text string, lang string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r == 'ß' || r >= 'a' && r <= 'z' || r >= 'à' && r <= 'ÿ')
+	})
+	padded := " " + strings.Join(words, " ") + " "
+	best := ""
+	for phrase := range WindowPhrases[lang] {
+		if strings.Contains(padded, " "+phrase+" ") && len(phrase) > len(best) {
+			best = phrase
+		}
+	}
+	return WindowPhrases[lang][best]
+}
+
+// answerIntent runs the handler for the given intent, falling back to the
+// default intent for unknown names
+func answerIntent(intent string, lang string, when string) (string, error) {
+	handler, found := intentHandlers[intent]
+	if !found {
+		handler = intentHandlers[defaultIntent]
+	}
+	return handler(lang, when)
+}
+
+// selectLanguage maps a locale like "de-DE" to a language for which texts
+// exist, using the configured language otherwise
+func selectLanguage(locale string) string {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if _, found := Texts["puffer"][lang]; found {
+		return lang
+	}
+	return language
+}
+
+// getCalendarSummaryMessage combines all calendar messages into one answer.
+// Time ranges which can't be parsed are ignored
+func getCalendarSummaryMessage(lang string, when string) (string, error) {
+	var msgs []string
+	var err error
+	if when != "" {
+		if _, werr := calendar.ParseWindow(when, time.Now()); werr != nil {
+			calendarLog.Warnf("Ignoring time range: %v", werr)
+			when = ""
+		}
+	}
+	if when == "" {
+		msgs, err = getCalendarMessages(lang)
+	} else {
+		msgs, err = getWindowMessages(when, lang)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(msgs, " "), nil
+}
@@ -0,0 +1,75 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import "testing"
+
+func TestMatchIntent(t *testing.T) {
+	for _, c := range []struct {
+		lang     string
+		text     string
+		expected string
+	}{
+		{"de", "Wie warm ist der Puffer?", "puffer"},
+		{"de", "Was steht heute im Kalender?", "calendar"},
+		{"de", "Habe ich morgen Termine?", "calendar"},
+		{"de", "Ist das Wasser heute schon warm?", "puffer"},
+		// The longer keyword is more specific
+		{"de", "Heute warm?", "calendar"},
+		{"de", "Wasser morgen?", ""},
+		{"de", "Wie spät ist es?", ""},
+		{"en", "How hot is the water?", "puffer"},
+		{"en", "What's on my calendar tomorrow?", "calendar"},
+		{"en", "Any appointments next week?", "calendar"},
+		{"en", "Hot today?", "calendar"},
+		{"en", "Tank week", ""},
+		{"en", "Hello", ""},
+		// Keywords of other languages don't count
+		{"en", "Wie heiß ist der Speicher?", ""},
+	} {
+		if intent := matchIntent(c.text, c.lang); intent != c.expected {
+			t.Errorf("%s '%s': expected intent %q, got %q", c.lang, c.text, c.expected, intent)
+		}
+	}
+}
+
+func TestMatchWindow(t *testing.T) {
+	for _, c := range []struct {
+		lang     string
+		text     string
+		expected string
+	}{
+		{"de", "Was habe ich heute vor?", "today"},
+		{"de", "Was ist heute Morgen los?", "today"},
+		{"de", "Und morgen?", "tomorrow"},
+		{"de", "Was habe ich nächste Woche vor?", "next-week"},
+		{"de", "Termine in der nächsten Woche", "next-week"},
+		{"de", "Was steht diese Woche an?", "week"},
+		{"de", "Was ist am Wochenende?", "weekend"},
+		{"de", "Termine am Freitag", "friday"},
+		{"de", "Wie warm ist es?", ""},
+		{"en", "What's on today?", "today"},
+		{"en", "Anything tomorrow?", "tomorrow"},
+		{"en", "And next week?", "next-week"},
+		{"en", "Plans for this weekend", "weekend"},
+		{"en", "What about this week", "week"},
+		{"en", "Appointments on Friday", "friday"},
+		{"en", "Morgen", ""},
+	} {
+		if window := matchWindow(c.text, c.lang); window != c.expected {
+			t.Errorf("%s '%s': expected window %q, got %q", c.lang, c.text, c.expected, window)
+		}
+	}
+}
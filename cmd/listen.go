@@ -0,0 +1,256 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/rhuss/puffer/pkg/speak"
+	"github.com/rhuss/puffer/pkg/version"
+	"github.com/rhuss/puffer/pkg/wyoming"
+	"github.com/spf13/cobra"
+)
+
+var listenLog = logging.New("listen")
+
+// listenCmd represents the listen command
+var listenCmd = &cobra.Command{
+	Use:   "listen",
+	Short: "Answer voice commands from a local speech-to-text engine",
+	Long: `Answer voice commands transcribed by a local speech-to-text engine
+
+	The transcribed text is matched against the puffer and calendar intents
+	in the current language and the answer is spoken out via audio. The text
+	is read from:
+
+	- stdin, one utterance per line (default)
+	- a Unix socket (--socket), one utterance per line. The answer is also
+	  written back on the connection.
+	- the Wyoming protocol (--wyoming) as a "handle" service for Rhasspy or
+	  Home Assistant. The answer is only returned in a "handled" event and
+	  not spoken here, as the satellite speaks it itself.
+
+	With --text phrases are answered directly and printed instead of spoken,
+	which is useful for testing the intent matching.
+	`,
+	RunE: listen,
+}
+
+var listenSocket string
+var listenWyoming string
+var listenTexts []string
+var listenPrint bool
+
+func listen(cmd *cobra.Command, args []string) error {
+	if replayPufferData != "" {
+		fetchPufferInfo = pufferInfoFromFile(replayPufferData)
+	}
+	if len(listenTexts) > 0 {
+		// All phrases are answered, the last failure decides the exit code
+		var failure error
+		for _, text := range listenTexts {
+			answer, err := answerUtterance(text, language)
+			if err != nil {
+				answer = fmt.Sprintf("ERROR: %v", err)
+				failure = err
+			}
+			fmt.Printf("%s --> %s\n", text, answer)
+		}
+		return failure
+	}
+
+	startCalendarSync()
+	if listenWyoming != "" {
+		address := strings.TrimPrefix(listenWyoming, "tcp://")
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		listenLog.Infof("Listening for Wyoming events on %s", address)
+		serveConnections(listener, handleWyomingConnection)
+	} else if listenSocket != "" {
+		os.Remove(listenSocket)
+		listener, err := net.Listen("unix", listenSocket)
+		if err != nil {
+			return err
+		}
+		listenLog.Infof("Listening for transcripts on %s", listenSocket)
+		serveConnections(listener, handleLineConnection)
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			respond(scanner.Text(), language)
+		}
+		return scanner.Err()
+	}
+	return nil
+}
+
+// serveConnections handles every incoming connection in its own goroutine
+// until the process is terminated
+func serveConnections(listener net.Listener, handle func(conn net.Conn)) {
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			listenLog.Errorf("Stop listening: %v", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
+
+// handleLineConnection answers one utterance per line
+func handleLineConnection(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		answer := respond(scanner.Text(), language)
+		if _, err := fmt.Fprintln(conn, answer); err != nil {
+			listenLog.Warnf("Cannot send answer: %v", err)
+			return
+		}
+	}
+}
+
+// handleWyomingConnection acts as a Wyoming "handle" service
+func handleWyomingConnection(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		event, err := wyoming.ReadEvent(reader)
+		if err != nil {
+			if err != io.EOF {
+				listenLog.Warnf("Cannot read Wyoming event: %v", err)
+			}
+			return
+		}
+
+		var reply *wyoming.Event
+		switch event.Type {
+		case "describe":
+			reply = wyomingInfo()
+		case "transcript":
+			lang := selectLanguage(event.String("language"))
+			// The satellite speaks the answer itself
+			if answer := answerText(event.String("text"), lang); answer != "" {
+				reply = &wyoming.Event{Type: "handled", Data: map[string]interface{}{"text": answer}}
+			} else {
+				reply = &wyoming.Event{Type: "not-handled"}
+			}
+		default:
+			continue
+		}
+		if err := wyoming.WriteEvent(conn, reply); err != nil {
+			listenLog.Warnf("Cannot write Wyoming event: %v", err)
+			return
+		}
+	}
+}
+
+// wyomingInfo describes puffer as intent handling service
+func wyomingInfo() *wyoming.Event {
+	languages := []string{}
+	for lang := range Texts["puffer"] {
+		languages = append(languages, lang)
+	}
+	return &wyoming.Event{
+		Type: "info",
+		Data: map[string]interface{}{
+			"handle": []interface{}{
+				map[string]interface{}{
+					"name":        "puffer",
+					"description": "Puffer storage and calendar information",
+					"attribution": map[string]string{"name": "puffer", "url": "https://github.com/rhuss/puffer"},
+					"installed":   true,
+					"version":     version.VERSION,
+					"languages":   languages,
+				},
+			},
+		},
+	}
+}
+
+// respond answers a transcribed text and speaks (or prints) the answer.
+// The answer is returned or the empty string if no answer could be created
+func respond(text string, lang string) string {
+	answer := answerText(text, lang)
+	if answer == "" {
+		return ""
+	}
+	if listenPrint {
+		fmt.Println(answer)
+		return answer
+	}
+	options, err := SpeakOptions()
+	if err == nil {
+		options.Language = lang
+		err = speak.Speak(answer, options)
+	}
+	if err != nil {
+		listenLog.Warnf("Cannot speak %v : %v", answer, err)
+	}
+	return answer
+}
+
+// answerText answers a transcribed text without speaking the answer. The
+// empty string is returned if no answer could be created
+func answerText(text string, lang string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	answer, err := answerUtterance(text, lang)
+	if err != nil {
+		listenLog.Warnf("Cannot answer '%s': %v", text, err)
+		return ""
+	}
+	return answer
+}
+
+// answerUtterance matches a text to an intent and creates the answer
+func answerUtterance(text string, lang string) (string, error) {
+	intent := matchIntent(text, lang)
+	listenLog.Infof("Utterance '%s' (%s) --> intent %s", text, lang, intent)
+	if intent == "" {
+		return Texts["not-understood"][lang], nil
+	}
+	return answerIntent(intent, lang, matchWindow(text, lang))
+}
+
+func init() {
+	RootCmd.AddCommand(listenCmd)
+
+	listenCmd.Flags().StringVar(&listenSocket, "socket", "", "Unix socket to read transcribed text from")
+	listenCmd.Flags().StringVar(&listenWyoming, "wyoming", "", "Address to serve the Wyoming protocol on, e.g. tcp://0.0.0.0:10700")
+	listenCmd.Flags().StringArrayVarP(&listenTexts, "text", "t", nil, "Phrase to answer directly (can be given multiple times)")
+	listenCmd.Flags().BoolVar(&listenPrint, "print", false, "Print answers instead of speaking them")
+	listenCmd.Flags().StringVar(&replayPufferData, "puffer-data", "", "JSON file with puffer data to use instead of querying InfluxDB")
+}
@@ -19,17 +19,23 @@ import (
 	"log"
 	"os"
 
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/rhuss/puffer/pkg/mqtt"
 	"github.com/rhuss/puffer/pkg/puffer"
 	"github.com/rhuss/puffer/pkg/speak"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var mainLog = logging.New("main")
+
 var cfgFile string
 var cfgDir string
 var gender string
 var language string
 var backend string
+var logLevel string
+var logFormat string
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -38,7 +44,18 @@ var RootCmd = &cobra.Command{
 	Long: `puffer: Managing data of a Sonnenkraft Puffer storage
 
 It can be used to query the current temperature of the puffer storage.
+
+Exit codes:
+
+	0 : Success
+	1 : Any other error
+	2 : Invalid command line or configuration
+	3 : Authentication at InfluxDB, the speech service or the calendar failed
+	4 : No puffer data or calendar found
+	5 : InfluxDB, the speech service or the calendar is unavailable
 	`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
 }
 
 var Texts = map[string]map[string]string{
@@ -70,30 +87,138 @@ var Texts = map[string]map[string]string{
 		"de": "%s.",
 		"en": "%s.",
 	},
+	"cal-none-further": {
+		"de": "Heute keine weiteren Termine.",
+		"en": "No further events today",
+	},
+	"cal-all-day-today": {
+		"de": "Heute ganztägig :",
+		"en": "All day today :",
+	},
+	"cal-ongoing": {
+		"de": "%s - läuft noch bis %s : %s",
+		"en": "%s - ongoing until %s : %s",
+	},
+	"cal-at-day": {
+		"de": "%s, %s",
+		"en": "%s, %s",
+	},
+	"cal-day-of": {
+		"de": " (Tag %d von %d)",
+		"en": " (day %d of %d)",
+	},
+	"cal-clock": {
+		"de": "%d Uhr",
+		"en": "%d o'clock",
+	},
+	"cal-clock-with-minute": {
+		"de": "%d Uhr %d",
+		"en": "%d %d",
+	},
+	"cal-none-window": {
+		"de": "Keine Termine.",
+		"en": "No events.",
+	},
+	"cal-day": {
+		"de": "%s :",
+		"en": "%s :",
+	},
+	"cal-today": {
+		"de": "Heute",
+		"en": "Today",
+	},
+	"cal-tomorrow-day": {
+		"de": "Morgen",
+		"en": "Tomorrow",
+	},
+	"cal-date": {
+		"de": "%[1]s, %[2]d. %[3]s",
+		"en": "%[1]s, %[3]s %[2]d",
+	},
+	"cal-location": {
+		"de": ", Ort: %s",
+		"en": ", at %s",
+	},
+	"cal-attendees": {
+		"de": ", mit %s",
+		"en": ", with %s",
+	},
+	"cal-more-attendees": {
+		"de": "%s und %d weiteren",
+		"en": "%s and %d more",
+	},
+	"cal-leave-by": {
+		"de": ", losfahren um %s",
+		"en": ", leave by %s",
+	},
+	"cal-reminder-minutes": {
+		"de": "Erinnerung, in %d Minuten :",
+		"en": "Reminder, in %d minutes :",
+	},
+	"cal-reminder-hour": {
+		"de": "Erinnerung, in einer Stunde :",
+		"en": "Reminder, in one hour :",
+	},
+	"cal-reminder-hours": {
+		"de": "Erinnerung, in %d Stunden :",
+		"en": "Reminder, in %d hours :",
+	},
+	"cal-reminder-day": {
+		"de": "Erinnerung für %s :",
+		"en": "Reminder for %s :",
+	},
+	"cal-reminder-now": {
+		"de": "Erinnerung, jetzt :",
+		"en": "Reminder, now :",
+	},
+	"cal-private": {
+		"de": "Privater Termin",
+		"en": "Private appointment",
+	},
+	"cal-reauthorize": {
+		"de": "Der Zugriff auf den Kalender muss neu erlaubt werden. Bitte puffer calendar auth aufrufen.",
+		"en": "The calendar access needs to be authorized again. Please run puffer calendar auth.",
+	},
+	"not-understood": {
+		"de": "Das habe ich leider nicht verstanden.",
+		"en": "Sorry, I didn't understand that.",
+	},
+	"failure": {
+		"de": "Das hat leider nicht geklappt.",
+		"en": "Sorry, something went wrong.",
+	},
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	RootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		fmt.Fprint(os.Stderr, cmd.UsageString())
+		return &configError{err}
+	})
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		mainLog.Errorf("%v", err)
+		os.Exit(exitCode(err))
 	}
 }
 
 // SpeakOptions create the options for the text to speech service
-func SpeakOptions() *speak.Options {
+func SpeakOptions() (*speak.Options, error) {
+	if backend == "record" {
+		// Doesn't need any credentials
+		return &speak.Options{Language: language, Backend: backend}, nil
+	}
 	ivonaConfig := viper.GetStringMapString("backend")
 	if ivonaConfig == nil {
-		log.Fatal("No authentication for speech backend configured")
+		return nil, configErrorf("No authentication for speech backend configured")
 	}
 	access, found := ivonaConfig["access"]
 	if !found {
-		log.Fatal("No access for speech backend found")
+		return nil, configErrorf("No access for speech backend found")
 	}
 	secret, found := ivonaConfig["secret"]
 	if !found {
-		log.Fatal("No secret given for accessing speech backend")
+		return nil, configErrorf("No secret given for accessing speech backend")
 	}
 	return &speak.Options{
 		Access:   access,
@@ -101,7 +226,16 @@ func SpeakOptions() *speak.Options {
 		Gender:   gender,
 		Language: language,
 		Backend:  backend,
+	}, nil
+}
+
+// speakText speaks a text with the configured speech backend
+func speakText(text string) error {
+	options, err := SpeakOptions()
+	if err != nil {
+		return err
 	}
+	return speak.Speak(text, options)
 }
 
 func PufferOptions() *puffer.Options {
@@ -113,6 +247,21 @@ func PufferOptions() *puffer.Options {
 	}
 }
 
+// MQTTOptions create the options for connecting to the MQTT broker
+func MQTTOptions() *mqtt.Options {
+	mqttConfig := viper.GetStringMapString("mqtt")
+	clientID, found := mqttConfig["client_id"]
+	if !found {
+		clientID = "puffer"
+	}
+	return &mqtt.Options{
+		Broker:   mqttConfig["broker"],
+		ClientID: clientID,
+		User:     mqttConfig["user"],
+		Password: mqttConfig["password"],
+	}
+}
+
 func ButtonMacAddress(what string) string {
 	buttonConfig := viper.GetStringMapString("buttons")
 	return buttonConfig[what]
@@ -129,7 +278,9 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cfgDir, "configdir", "", "directory holding configuration. Default: $HOME/.puffer")
 	RootCmd.PersistentFlags().StringVarP(&gender, "gender", "g", "female", "Gender of voice to use (male or female)")
 	RootCmd.PersistentFlags().StringVarP(&language, "language", "l", "de", "Language to use ('de' or 'en')")
-	RootCmd.PersistentFlags().StringVarP(&backend, "backend", "b", "polly", "Service type ('ivona' or 'polly')")
+	RootCmd.PersistentFlags().StringVarP(&backend, "backend", "b", "polly", "Service type ('ivona', 'polly' or 'record' for printing instead of speaking)")
+	RootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimal level of log messages ('debug', 'info', 'warn' or 'error')")
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatLogfmt, "Format of log messages ('logfmt' or 'json')")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	// RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -137,6 +288,8 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	initLogging()
+
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
@@ -151,22 +304,53 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("cannot read config file (configdir: %s), (config: %s)", cfgDir, cfgFile)
+		mainLog.Errorf("cannot read config file (configdir: %s), (config: %s): %v", cfgDir, cfgFile, err)
+		os.Exit(exitConfig)
 	}
 
-	log.Println("Using config file:", viper.ConfigFileUsed(), "--- config dir:",viper.GetString("configdir"))
+	mainLog.Infof("Using config file: %s --- config dir: %s", viper.ConfigFileUsed(), viper.GetString("configdir"))
+	registerSecrets()
+}
+
+// initLogging sets up logging as given by the flags. Messages of the
+// standard logger, e.g. from libraries, are logged as well
+func initLogging() {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		mainLog.Errorf("%v", err)
+		os.Exit(exitConfig)
+	}
+	logging.SetLevel(level)
+	if err := logging.SetFormat(logFormat); err != nil {
+		mainLog.Errorf("%v", err)
+		os.Exit(exitConfig)
+	}
+	log.SetFlags(0)
+	log.SetOutput(mainLog.Writer(logging.Info))
+}
+
+// registerSecrets makes sure that credentials from the configuration never
+// show up in log messages
+func registerSecrets() {
+	for _, key := range []string{"backend.access", "backend.secret", "influxdb.password", "mqtt.password", "webhook.token", "hooks.token"} {
+		logging.Secret(viper.GetString(key))
+	}
+}
 
+// fetchPufferInfo retrieves the current puffer data. It can be replaced
+// for working on recorded data
+var fetchPufferInfo = func() (*puffer.Info, error) {
+	return puffer.FetchPufferData(PufferOptions())
 }
 
-func getPufferSummaryMessage() (string, error) {
-	pufferData, err := puffer.FetchPufferData(PufferOptions())
+func getPufferSummaryMessage(lang string) (string, error) {
+	pufferData, err := fetchPufferInfo()
 	if err != nil {
-		fmt.Print(err)
 		return "", err
 	}
-	log.Print("Puffer info fetched")
+	mainLog.Debugf("Puffer info fetched")
 
-	var format = Texts["puffer"][language]
+	var format = Texts["puffer"][lang]
 	msg := fmt.Sprintf(format,
 		int(pufferData.HighTemp+0.5), int(pufferData.MidTemp+0.5),
 		int(pufferData.LowTemp+0.5), int(pufferData.CollectorTemp+0.5))
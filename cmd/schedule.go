@@ -0,0 +1,173 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/cron"
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/rhuss/puffer/pkg/policy"
+	"github.com/rhuss/puffer/pkg/trigger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var scheduleLog = logging.New("schedule")
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run scheduled announcements",
+	Long: `Run the actions of all triggers of type "cron" on their schedule
+
+	This is the same as "watch" but without any other triggers than those of
+	type "cron" and "reminder". Scheduled triggers and reminders don't run
+	during the quiet hours of the "policy" section (see "puffer watch --help").
+	Holidays are configured in the "schedule" section of the configuration:
+
+	- holidays    : Calendars whose all-day events mark holidays, given like
+	                "calendars" in the root configuration. Triggers with
+	                "skip_holidays" set don't run on these days.
+
+	With --dry-run the next fire times of each scheduled trigger are printed
+	instead, including whether they would be skipped.
+	`,
+	RunE: schedule,
+}
+
+var scheduleDryRun bool
+var scheduleCount int
+
+func schedule(cmd *cobra.Command, args []string) error {
+	if scheduleDryRun {
+		return printSchedule(scheduleCount)
+	}
+	return runTriggers(func(t *trigger.Config) bool { return t.Type == "cron" || t.Type == "reminder" })
+}
+
+// printSchedule prints the next fire times of all scheduled triggers
+func printSchedule(count int) error {
+	_, triggers, scheduler, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+	return writeSchedule(os.Stdout, triggers, scheduler, time.Now(), count)
+}
+
+// writeSchedule writes the next fire times after now of all scheduled triggers
+func writeSchedule(w io.Writer, triggers map[string]*trigger.Config, scheduler *scheduler, now time.Time, count int) error {
+	names := []string{}
+	for name, t := range triggers {
+		if t.Type == "cron" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := triggers[name]
+		s, err := cron.Parse(t.Cron)
+		if err != nil {
+			return configErrorf("Invalid cron expression for trigger %s: %v", name, err)
+		}
+		fmt.Fprintf(w, "%s (%s) --> %s\n", name, t.Cron, t.Action)
+		next := now
+		for i := 0; i < count; i++ {
+			next = s.Next(next)
+			if next.IsZero() {
+				break
+			}
+			fmt.Fprintf(w, "    %s", next.Format("Mon 2006-01-02 15:04"))
+			if reason := scheduler.skipReason(t, next); reason != "" {
+				fmt.Fprintf(w, "  (skipped: %s)", reason)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
+
+// scheduler decides whether scheduled triggers should run
+type scheduler struct {
+	quietHours policy.QuietHours
+	// whether holiday calendars are configured and their providers, which
+	// are created when needed. Their events are kept by the calendar cache
+	checkHolidays bool
+	holidays      []calendar.Provider
+}
+
+func newScheduler() (*scheduler, error) {
+	quietHours, err := loadQuietHours()
+	if err != nil {
+		return nil, err
+	}
+	return &scheduler{
+		quietHours:    quietHours,
+		checkHolidays: viper.IsSet("schedule.holidays"),
+	}, nil
+}
+
+// skipReason returns why a scheduled trigger should not run at the given time
+// or the empty string if it should run
+func (s *scheduler) skipReason(t *trigger.Config, at time.Time) string {
+	if reason := s.quietHours.Check(at); reason != "" {
+		return reason
+	}
+	if t.SkipHolidays && s.checkHolidays {
+		holiday, err := s.holiday(at)
+		if err != nil {
+			// Better announce too much than nothing at all
+			scheduleLog.Warnf("Cannot check for holiday: %v", err)
+			return ""
+		}
+		if holiday != "" {
+			return "holiday " + holiday
+		}
+	}
+	return ""
+}
+
+// holiday returns the name of the holiday on the given day or "" if
+// there is none
+func (s *scheduler) holiday(day time.Time) (string, error) {
+	if s.holidays == nil {
+		holidays, err := calendarProviders("schedule.holidays")
+		if err != nil {
+			return "", err
+		}
+		s.holidays = holidays
+	}
+	events, err := calendar.GetAllDayEvents(s.holidays, day)
+	if err != nil {
+		return "", err
+	}
+	if events == nil {
+		return "", nil
+	}
+	return eventSummary((*events)[0], language), nil
+}
+
+func init() {
+	RootCmd.AddCommand(scheduleCmd)
+
+	scheduleCmd.Flags().BoolVar(&scheduleDryRun, "dry-run", false, "Print the next fire times instead of running the schedule")
+	scheduleCmd.Flags().IntVarP(&scheduleCount, "count", "n", 5, "Number of fire times to print per trigger with --dry-run")
+}
@@ -0,0 +1,85 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+	"github.com/rhuss/puffer/pkg/policy"
+	"github.com/rhuss/puffer/pkg/trigger"
+)
+
+// dayCalendar is a calendar with fixed events, of which only those in the
+// requested window are returned
+type dayCalendar []calendar.Item
+
+func (c dayCalendar) Name() string {
+	return "Feiertage"
+}
+
+func (c dayCalendar) Items(start time.Time, end time.Time) ([]calendar.Item, error) {
+	ret := []calendar.Item{}
+	for _, item := range c {
+		if item.Start.Before(end) && item.End.After(start) {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
+
+func TestWriteSchedule(t *testing.T) {
+	// Sleeping in on Sunday
+	quietHours, err := policy.ParseQuietHours(map[string][]string{"default": {"22:00-07:00"}, "sat": {"22:00-09:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Good Friday
+	holiday := time.Date(2017, 4, 14, 0, 0, 0, 0, time.Local)
+	s := &scheduler{
+		quietHours:    quietHours,
+		checkHolidays: true,
+		holidays:      []calendar.Provider{dayCalendar{{Summary: "Karfreitag", Start: holiday, End: holiday.AddDate(0, 0, 1), AllDay: true}}},
+	}
+	triggers := map[string]*trigger.Config{
+		"waste":   {Name: "waste", Type: "cron", Cron: "30 7 * * thu,fri", Action: "waste", SkipHolidays: true},
+		"morning": {Name: "morning", Type: "cron", Cron: "0 8 * * *", Action: "today"},
+		"door":    {Name: "door", Type: "http", Path: "/door", Action: "door"},
+	}
+
+	var out bytes.Buffer
+	if err := writeSchedule(&out, triggers, s, time.Date(2017, 4, 13, 9, 0, 0, 0, time.Local), 3); err != nil {
+		t.Fatal(err)
+	}
+	expected := `morning (0 8 * * *) --> today
+    Fri 2017-04-14 08:00
+    Sat 2017-04-15 08:00
+    Sun 2017-04-16 08:00  (skipped: quiet hours 22:00-09:00)
+waste (30 7 * * thu,fri) --> waste
+    Fri 2017-04-14 07:30  (skipped: holiday Karfreitag)
+    Thu 2017-04-20 07:30
+    Fri 2017-04-21 07:30
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	triggers["broken"] = &trigger.Config{Name: "broken", Type: "cron", Cron: "0 8 * *"}
+	if err := writeSchedule(&out, triggers, s, time.Now(), 3); exitCode(err) != 2 {
+		t.Errorf("expected configuration error, got %v", err)
+	}
+}
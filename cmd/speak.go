@@ -29,8 +29,8 @@ var speakCmd = &cobra.Command{
 	- afplay for OSX
 	- mpg123 for Linux
 	`,
-	Run: func(cmd *cobra.Command, args []string) {
-		PufferButtonPushed()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return speakPufferSummary()
 	},
 }
 
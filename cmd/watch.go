@@ -15,207 +15,304 @@
 package cmd
 
 import (
-	"errors"
-	"log"
+	"fmt"
 	"net"
+	"path/filepath"
 
-	"github.com/rhuss/puffer/pkg/speak"
+	"github.com/mitchellh/mapstructure"
+	"github.com/rhuss/puffer/pkg/button"
+	"github.com/rhuss/puffer/pkg/logging"
+	"github.com/rhuss/puffer/pkg/netif"
+	"github.com/rhuss/puffer/pkg/trigger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/rhuss/dash"
-	"path/filepath"
-	"os"
-	"encoding/json"
-	"golang.org/x/oauth2"
-	"fmt"
-	"io/ioutil"
-	"github.com/rhuss/puffer/pkg/calendar"
 )
 
+var watchLog = logging.New("watch")
+
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
 	Use:   "watch",
-	Short: "Watch for the press of a Amazon Dash button",
-	Long: `Watch the press of a Amazon Dash button
+	Short: "Watch for triggers like the press of a Amazon Dash button",
+	Long: `Watch for triggers and run the actions mapped to them
+
+	Triggers are configured in the "triggers" section as a list. Each trigger
+	has a name, a type and the name of the action to run:
+
+	- button : Press of an Amazon Dash button, given by "mac" or by the name
+	           of an entry in the "buttons" section with "button". Optionally
+	           "double" is the action for two presses within "window" (8s by
+	           default) and "stop" the action for a press while an
+	           announcement is playing, which stops it by default. Packets
+	           within "debounce" (5s by default, 2s with "double") belong
+	           to the same press, so a second press is only recognized
+	           after the debounce and the window must be longer than it.
+	           Presses are detected by ARP probes, gratuitous ARP, DHCP
+	           requests and mDNS announcements, which can be restricted with
+	           "detect" (arp-probe, gratuitous-arp, dhcp, mdns).
+	- mqtt   : Message published on "topic" at the broker configured in the
+	           "mqtt" section (broker, client_id, user, password)
+	- http   : POST request to "path" on the address given by "hooks.address"
+	           (127.0.0.1:8089 by default). The request must carry "token"
+	           or, if not given, "hooks.token" as bearer token in the
+	           Authorization header. The body is the payload.
+	- cron   : Schedule given as cron expression in "cron". It doesn't run
+	           during the quiet hours of the policy (see below) and, with
+	           "skip_holidays" set, on holidays (see "puffer schedule")
+	- gpio   : GPIO input "pin" becoming active (set "active_low" if needed)
+	- reminder : Timed event in the "calendars" starting soon. Events are
+	           reminded of according to their own reminders or, without
+	           any, the durations listed in "before", like [15m]. Events
+	           are looked for four weeks ahead, so that longer reminders of
+	           their own fire only then. Use the action "say" for
+	           announcing the reminder. Quiet hours apply like for "cron"
+	           triggers.
+
+	Buttons are watched on the interfaces given by "interface" (a name or a
+	list like [eth0, wlan0]), by default on the interface of the default route.
+	Capturing packets requires CAP_NET_RAW. Without it, presses can be
+	detected from the DHCP requests logged by a DHCP server like dnsmasq,
+	either by following the log file given by "detection.log" or by
+	receiving syslog messages on the UDP address "detection.syslog". Only
+	"dhcp" presses are detected this way.
 
+	Built-in actions are "puffer", "calendar", "stop", which stops the current
+	announcement, "say", which speaks the payload of the trigger, and "dnd",
+	which switches "do not disturb" on or off according to the payload or
+	toggles it without one.
+	Custom actions are defined
+	in the "actions" section with one of these types:
+
+	- template : Speak the Go template given in "template"
+	- shell    : Run "command" and speak its output if "speak" is set
+	- calendar : Speak the events within "when", e.g. "tomorrow" or "weekend"
+	             (see "puffer calendar --help")
+	- chain    : Run all actions listed in "actions"
+
+	Without any triggers configured the buttons "puffer" and "calendar" run
+	the action of the same name.
+
+	Before anything is announced, the policy in the "policy" section is
+	consulted, which suppresses announcements during "quiet_hours" (time
+	windows per day of week like "mon" or "default"), while "do not disturb"
+	is on or when none of the "presence.devices" (MAC addresses of phones) has
+	been seen within "presence.timeout" on the network. With "queue" set,
+	suppressed announcements are spoken as soon as the policy allows it.
+	Scheduled triggers and reminders don't run at all during quiet hours.
+	Presence is detected from the DHCP server log instead of captured
+	packets if "detection.log" or "detection.syslog" is given.
+
+	With --discover no triggers are watched. Instead, devices sending
+	packets like a pressed button are listed together with their vendor,
+	and can be saved under a name in the "buttons" section. Only YAML
+	configuration files are changed, keeping their comments where possible.
+	Otherwise the original file is kept with the suffix ".bak".
+
+	With --pcap the packets of a pcap file (e.g. recorded with
+	"tcpdump -w presses.pcap arp or port 67") are replayed instead of watching
+	the network. Only button triggers are considered and the policy is
+	ignored. Together with "--backend record", which prints announcements
+	instead of speaking them, this runs without network, root and audio:
+
+	    puffer watch --pcap presses.pcap --backend record
 	`,
-	Run: watch,
+	RunE: watch,
 }
 
-func watch(cmd *cobra.Command, args []string) {
-	netInterface := viper.GetString("interface")
-	if netInterface == "" {
-		netInterface = "en3"
-	}
+var watchDiscover bool
+var watchPcap string
 
-	iface, err := net.InterfaceByName(netInterface)
-	if err != nil {
-		panic(err)
+func watch(cmd *cobra.Command, args []string) error {
+	if watchDiscover {
+		return discoverButtons()
 	}
+	if watchPcap != "" {
+		return replayPcap(watchPcap)
+	}
+	return runTriggers(func(*trigger.Config) bool { return true })
+}
 
-	addr, err := extractAddress(iface)
+// runTriggers watches for all configured triggers accepted by the filter and
+// runs their actions one after the other
+func runTriggers(filter func(*trigger.Config) bool) error {
+	actions, triggers, scheduler, err := loadConfiguration()
 	if err != nil {
-		panic(err)
-	}
-
-	log.Printf("Using network range %v for interface %v", addr, iface.Name)
-	pufferChan := dash.WatchButton(iface, ButtonMacAddress("puffer"))
-	calendarChan := dash.WatchButton(iface, ButtonMacAddress("calendar"))
-    for {
-		select {
-		case <- *pufferChan:
-			PufferButtonPushed()
-		case <- *calendarChan:
-			CalendarButtonPushed()
+		return err
+	}
+	buttons := trigger.NewButtonSource(watchInterfaces, viper.GetStringMapString("buttons"))
+	buttons.ReadLogs(viper.GetString("detection.log"), viper.GetString("detection.syslog"))
+	if err := setupPolicy(buttons, scheduler.quietHours); err != nil {
+		return asConfigError(err)
+	}
+	sources := trigger.Sources{
+		"button": buttons,
+		"mqtt":   trigger.NewMQTTSource(MQTTOptions()),
+		"http":   trigger.NewHTTPSource(viper.GetString("hooks.address"), viper.GetString("hooks.token")),
+		"cron":   trigger.NewCronSource(),
+		"gpio":   trigger.NewGPIOSource(),
+		"reminder": trigger.NewReminderSource(reminderEvents, reminderText,
+			filepath.Join(viper.GetString("configdir"), "reminders.json")),
+	}
+	for _, t := range triggers {
+		if !filter(t) {
+			continue
+		}
+		if err := sources.Add(t); err != nil {
+			return asConfigError(err)
 		}
 	}
+	events := make(chan trigger.Event)
+	if err := sources.Start(events); err != nil {
+		return err
+	}
+	startCalendarSync()
+
+	newDispatcher(triggers, actions, scheduler).run(events)
+	return nil
 }
-func CalendarButtonPushed() {
-	log.Print("Calendar Button pushed")
 
-	jsonKey, err := ioutil.ReadFile(filepath.Join(viper.GetString("configdir"), "google-client-secret.json"))
+// loadConfiguration loads the actions, the triggers and the scheduler
+func loadConfiguration() (map[string]action, map[string]*trigger.Config, *scheduler, error) {
+	actions, err := loadActions()
 	if err != nil {
-		fmt.Printf("Unable to read client secret file: %v", err)
-		return
+		return nil, nil, nil, asConfigError(err)
 	}
-
-	tokenCache := filepath.Join(viper.GetString("configdir"), "calendar-token.json")
-	token, err := tokenFromFile(tokenCache)
+	triggers, err := loadTriggers(actions)
 	if err != nil {
-		token, err = calendar.FetchToken(jsonKey)
-		if err != nil {
-			fmt.Printf("Cannot fetch token: %v", err)
-			return
-		}
-		saveToken(tokenCache, token)
+		return nil, nil, nil, asConfigError(err)
 	}
-	events, err := calendar.GetNextEvents(token, jsonKey, viper.GetStringSlice("calendars"), viper.GetStringSlice("allday"))
+	scheduler, err := newScheduler()
 	if err != nil {
-		fmt.Printf("Cannot fetch events: %v", err)
-		return
+		return nil, nil, nil, asConfigError(err)
 	}
+	return actions, triggers, scheduler, nil
+}
 
-	if events.TodayEvents != nil {
-		for _, event := range *events.TodayEvents {
-			if err := speak.Speak(getEventMessage(event), SpeakOptions()); err != nil {
-				fmt.Printf("Cannot speak %v : %v", getEventMessage(event), err)
-				return
-			}
+// replayPcap runs the actions of the button triggers pressed in a pcap file
+func replayPcap(file string) error {
+	actions, triggers, scheduler, err := loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	source := trigger.NewButtonSource(watchInterfaces, viper.GetStringMapString("buttons"))
+	buttons := map[string]*trigger.Config{}
+	for name, t := range triggers {
+		if t.Type != "button" {
+			continue
 		}
-	} else {
-		if err := speak.Speak(Texts["cal-none"][language], SpeakOptions()); err != nil {
-			fmt.Printf("Cannot speak cal-none: %v",err)
-			return
+		if err := source.Add(t); err != nil {
+			return asConfigError(err)
 		}
+		buttons[name] = t
+	}
 
-		if events.TomorrowEvents != nil {
-			if err := speak.Speak(Texts["cal-tomorrow"][language], SpeakOptions()); err != nil {
-				fmt.Printf("Cannot speak cal-tomorrow: %v", err)
-				return
-			}
-			for _, event := range *events.TomorrowEvents {
-				if err := speak.Speak(getEventMessage(event), SpeakOptions()); err != nil {
-					fmt.Printf("Cannot speak %v : %v", getEventMessage(event), err)
-					return
-				}
+	events := make(chan trigger.Event)
+	d := newDispatcher(buttons, actions, scheduler)
+	d.replay = true
+	var replayErr error
+	go func() {
+		replayErr = source.Replay(file, events)
+		close(events)
+	}()
+	d.run(events)
+	return replayErr
+}
+
+// unmarshalKey decodes a part of the configuration like viper.UnmarshalKey
+// does, but also accepts durations like "8s"
+func unmarshalKey(key string, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(viper.Get(key))
+}
+
+// loadTriggers reads the triggers from the configuration. Without any
+// triggers configured, the buttons "puffer" and "calendar" are mapped
+// to the actions of the same name
+func loadTriggers(actions map[string]action) (map[string]*trigger.Config, error) {
+	var configs []trigger.Config
+	if err := unmarshalKey("triggers", &configs); err != nil {
+		return nil, fmt.Errorf("invalid triggers configuration: %v", err)
+	}
+	if len(configs) == 0 {
+		for _, name := range []string{"puffer", "calendar"} {
+			if ButtonMacAddress(name) != "" {
+				configs = append(configs, trigger.Config{
+					Name:   name,
+					Type:   "button",
+					Button: name,
+					Action: name,
+				})
 			}
 		}
 	}
 
-	if events.TomorrowAllDayEvents != nil {
-		if err := speak.Speak(Texts["cal-reminder-tomorrow"][language], SpeakOptions()); err != nil {
-			fmt.Printf("Cannot speak cal-reminder-tomorrow: %v",err)
-			return
+	triggers := map[string]*trigger.Config{}
+	for i := range configs {
+		t := &configs[i]
+		if _, found := triggers[t.Name]; found {
+			return nil, fmt.Errorf("duplicate trigger %s", t.Name)
 		}
-		for _, event := range *events.TomorrowAllDayEvents {
-			msg := fmt.Sprintf(Texts["cal-event-no-time"][language], event.Summary)
-			if err:= speak.Speak(msg, SpeakOptions()); err != nil {
-				fmt.Printf("Cannot speak cal-event-no-time: %v", err)
-				return
+		for _, name := range []string{t.Action, t.Double, t.Stop} {
+			if _, found := actions[name]; name != "" && !found {
+				return nil, fmt.Errorf("unknown action '%s' for trigger %s", name, t.Name)
 			}
 		}
+		if t.Action == "" {
+			return nil, fmt.Errorf("no action for trigger %s", t.Name)
+		}
+		if t.Double != "" {
+			window, debounce := t.Window, t.Debounce
+			if window == 0 {
+				window = defaultPressWindow
+			}
+			if debounce == 0 {
+				debounce = button.DoubleDebounce
+			}
+			if debounce >= window {
+				return nil, fmt.Errorf("debounce of trigger %s (%s) must be shorter than its window (%s) to recognize double presses", t.Name, debounce, window)
+			}
+		}
+		triggers[t.Name] = t
 	}
-}
-func getEventMessage(event calendar.TimedEvent) string {
-	var text string
-	min := event.Start.Minute()
-	if min == 0 {
-		text = fmt.Sprintf(Texts["cal-timed-event"][language],
-			event.Calendar, event.Start.Hour(), event.Summary)
-	} else {
-		text = fmt.Sprintf(Texts["cal-timed-event-with-minute"][language],
-			event.Calendar, event.Start.Hour(), min, event.Summary)
-	}
-	return text
+	return triggers, nil
 }
 
-
-// tokenFromFile retrieves a Token from a given file path.
-// It returns the retrieved Token and any read error encountered.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-  f, err := os.Open(file)
-  if err != nil {
-    return nil, err
-  }
-  t := &oauth2.Token{}
-  err = json.NewDecoder(f).Decode(t)
-  defer f.Close()
-  return t, err
-}
-
-// saveToken uses a file path to create a file and store the
-// token in it.
-func saveToken(file string, token *oauth2.Token) {
-  fmt.Printf("Saving credential file to: %s\n", file)
-  f, err := os.Create(file)
-  if err != nil {
-    log.Fatalf("Unable to cache oauth token: %v", err)
-  }
-  defer f.Close()
-  json.NewEncoder(f).Encode(token)
-}
-
-
-func PufferButtonPushed() {
-	log.Print("Puffer Button pushed")
-	msg, err := getPufferSummaryMessage()
+// watchInterfaces looks up the network interfaces to watch for buttons,
+// given by "interface" as a single name or a list. Without any configured,
+// the interface of the default route is used
+func watchInterfaces() ([]*net.Interface, error) {
+	if err := netif.CheckCapture(); err != nil {
+		return nil, err
+	}
+	candidates, err := netif.Candidates()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	speak.Speak(msg, SpeakOptions())
-}
-
-func extractAddress(iface *net.Interface) (*net.IPNet, error) {
-	var addr *net.IPNet
-	if addrs, err := iface.Addrs(); err != nil {
+	selected, err := netif.Select(viper.GetStringSlice("interface"), candidates, netif.DefaultRoute())
+	if err != nil {
 		return nil, err
-	} else {
-		for _, a := range addrs {
-			if ipnet, ok := a.(*net.IPNet); ok {
-				if ip4 := ipnet.IP.To4(); ip4 != nil {
-					addr = &net.IPNet{
-						IP:   ip4,
-						Mask: ipnet.Mask[len(ipnet.Mask) - 4:],
-					}
-					break
-				}
-			}
-		}
 	}
-	// Sanity-check that the interface has a good address.
-	if addr == nil {
-		return nil, errors.New("no good IP network found")
-	} else if addr.IP[0] == 127 {
-		return nil, errors.New("skipping localhost")
-	} else if addr.Mask[0] != 0xff || addr.Mask[1] != 0xff {
-		return nil, errors.New("mask means network is too large")
+	ifaces := []*net.Interface{}
+	for i := range selected {
+		watchLog.Infof("Watching interface %s", netif.Describe(selected[i]))
+		ifaces = append(ifaces, &selected[i].Interface)
 	}
-	return addr, nil
+	return ifaces, nil
 }
 
 func init() {
 	RootCmd.AddCommand(watchCmd)
 
+	watchCmd.Flags().BoolVar(&watchDiscover, "discover", false, "Discover buttons and add them to the configuration")
+	watchCmd.Flags().StringVar(&watchPcap, "pcap", "", "Replay the packets of a pcap file instead of watching the network")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,69 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhuss/puffer/pkg/speak"
+	"github.com/spf13/viper"
+)
+
+// Configuration for replaying testdata/presses.pcap, which holds the DHCP
+// packets of a single button: a press (DISCOVER and REQUEST 1s apart), two
+// presses 4s apart 30s later and another press 30s after those
+const replayConfig = `
+buttons:
+  kitchen: fc:a6:67:77:88:99
+actions:
+  single:
+    type: template
+    template: "Single press of {{.Trigger}}"
+  double:
+    type: template
+    template: "Double press of {{.Trigger}}"
+triggers:
+  - name: kitchen
+    type: button
+    button: kitchen
+    action: single
+    double: double
+    window: 8s
+`
+
+func TestReplayPcap(t *testing.T) {
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(replayConfig)); err != nil {
+		t.Fatal(err)
+	}
+	var recorded bytes.Buffer
+	oldBackend, oldRecorder := backend, speak.Recorder
+	backend, speak.Recorder = "record", &recorded
+	defer func() {
+		backend, speak.Recorder = oldBackend, oldRecorder
+		viper.Reset()
+	}()
+
+	if err := replayPcap(filepath.Join("testdata", "presses.pcap")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Single press of kitchen\nDouble press of kitchen\nSingle press of kitchen\n"
+	if recorded.String() != expected {
+		t.Errorf("expected announcements\n%s\ngot\n%s", expected, recorded.String())
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// webhookRequest covers both supported request formats: Dialogflow
+// fulfillment requests and the simple {"query": ...} contract
+type webhookRequest struct {
+	// Simple format
+	Query    string `json:"query"`
+	Language string `json:"language"`
+	Intent   string `json:"intent"`
+
+	// Dialogflow fulfillment format
+	QueryResult *struct {
+		QueryText    string `json:"queryText"`
+		LanguageCode string `json:"languageCode"`
+		Intent       struct {
+			DisplayName string `json:"displayName"`
+		} `json:"intent"`
+	} `json:"queryResult"`
+}
+
+// webhookHandler answers conversational webhook requests with the same
+// intents as the Alexa skill. The token must be provided as bearer token
+func webhookHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !validBearerToken(r, token) {
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		dialogflow := req.QueryResult != nil
+		query, locale, intentName := req.Query, req.Language, req.Intent
+		if dialogflow {
+			query = req.QueryResult.QueryText
+			locale = req.QueryResult.LanguageCode
+			intentName = req.QueryResult.Intent.DisplayName
+		}
+		lang := selectLanguage(locale)
+		intent := resolveIntent(intentName)
+		if intent == "" {
+			intent = matchIntent(query, lang)
+		}
+		alexaLog.Infof("Webhook query '%s' (%s) --> intent %s", query, lang, intent)
+
+		msg, err := answerIntent(intent, lang, matchWindow(query, lang))
+		if err != nil {
+			alexaLog.Warnf("Cannot answer intent %s: %v", intent, err)
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		var resp interface{}
+		if dialogflow {
+			resp = map[string]string{"fulfillmentText": msg}
+		} else {
+			resp = map[string]string{"speech": msg}
+		}
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// validBearerToken checks the bearer token of the request, which must not
+// be empty
+func validBearerToken(r *http.Request, token string) bool {
+	given := r.Header.Get("Authorization")
+	expected := "Bearer " + token
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,53 @@
+// Copyright © 2016 Roland Huss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookRequiresToken(t *testing.T) {
+	defer withAlexaReplay(alexaTestAppID)()
+	for _, c := range []struct {
+		token         string
+		path          string
+		authorization string
+		code          int
+	}{
+		{"secret", "/webhook", "Bearer secret", http.StatusOK},
+		{"secret", "/webhook", "", http.StatusUnauthorized},
+		{"secret", "/webhook", "Bearer secre", http.StatusUnauthorized},
+		{"secret", "/webhook", "secret", http.StatusUnauthorized},
+		// Tokens in the URL end up in logs
+		{"secret", "/webhook?token=secret", "", http.StatusUnauthorized},
+		{"", "/webhook", "Bearer ", http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest("POST", c.path, strings.NewReader(`{"intent": "puffer", "language": "de"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		webhookHandler(c.token).ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("token %q, %s with %q: expected HTTP %d, got %d", c.token, c.path, c.authorization, c.code, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package button
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Number of packets within burstWindow after which a device is reported.
+// Buttons send a couple of packets in quick succession when pressed
+const (
+	burstPackets = 2
+	burstWindow  = 10 * time.Second
+)
+
+// Device is a possible button found during discovery
+type Device struct {
+	MAC    net.HardwareAddr
+	Vendor string
+	// Kind of the packets by which the device has been found
+	Kind string
+	Time time.Time
+}
+
+// Discoverer looks for devices which send packets like a button when it is
+// pressed. Every device is reported only once.
+type Discoverer struct {
+	mutex    sync.Mutex
+	ignore   map[string]bool
+	reported map[string]bool
+	seen     map[string][]time.Time
+}
+
+// NewDiscoverer creates a discoverer which ignores the given MAC addresses,
+// e.g. of buttons already configured
+func NewDiscoverer(ignore []net.HardwareAddr) *Discoverer {
+	d := &Discoverer{
+		ignore:   map[string]bool{},
+		reported: map[string]bool{},
+		seen:     map[string][]time.Time{},
+	}
+	for _, mac := range ignore {
+		d.ignore[mac.String()] = true
+	}
+	return d
+}
+
+// Discover opens a packet capture on the interface and sends every newly
+// found device in the background
+func (d *Discoverer) Discover(iface *net.Interface, devices chan<- Device) error {
+	return capture(iface, func(packet gopacket.Packet) {
+		if device := d.Handle(packet); device != nil {
+			devices <- *device
+		}
+	})
+}
+
+// Handle checks whether a packet completes a burst of an unknown device and
+// returns the device in this case, nil otherwise
+func (d *Discoverer) Handle(packet gopacket.Packet) *Device {
+	mac, kind := detect(packet)
+	if mac == nil {
+		return nil
+	}
+	at := packet.Metadata().Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	key := mac.String()
+	if d.ignore[key] || d.reported[key] {
+		return nil
+	}
+	burst := []time.Time{at}
+	for _, t := range d.seen[key] {
+		if at.Sub(t) < burstWindow {
+			burst = append(burst, t)
+		}
+	}
+	if len(burst) < burstPackets {
+		d.seen[key] = burst
+		return nil
+	}
+	delete(d.seen, key)
+	d.reported[key] = true
+	return &Device{
+		MAC:    mac,
+		Vendor: Vendor(mac),
+		Kind:   kind,
+		Time:   at,
+	}
+}
@@ -0,0 +1,131 @@
+package button
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Interval for checking a followed log file for new lines
+const tailInterval = 500 * time.Millisecond
+
+// MAC address as logged by DHCP servers like dnsmasq or ISC dhcpd
+var macPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?::[0-9a-f]{2}){5}\b`)
+
+// HandleLine checks whether a log line of a DHCP server reports a DISCOVER
+// or REQUEST of one of the buttons and returns the event for it, nil
+// otherwise. This allows to detect presses without capturing packets
+func (w *Watcher) HandleLine(line string, at time.Time) *Event {
+	if !strings.Contains(line, "DHCP") {
+		return nil
+	}
+	w.mutex.Lock()
+	clients := w.clients
+	w.mutex.Unlock()
+	request := strings.Contains(line, "DHCPDISCOVER") || strings.Contains(line, "DHCPREQUEST")
+	var event *Event
+	for _, match := range macPattern.FindAllString(line, -1) {
+		mac, err := net.ParseMAC(match)
+		if err != nil {
+			continue
+		}
+		if clients != nil {
+			clients(mac, at)
+		}
+		if request && event == nil {
+			event = w.press(mac, DHCP, at)
+		}
+	}
+	return event
+}
+
+// Tail follows a log file in the background and sends an event for every
+// press found in new lines. Rotated files are reopened.
+func (w *Watcher) Tail(file string, events chan<- Event) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	// Only new lines are of interest
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	go func() {
+		reader := bufio.NewReader(f)
+		partial := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err == nil {
+				if event := w.HandleLine(partial+line, time.Now()); event != nil {
+					events <- *event
+				}
+				partial = ""
+				continue
+			}
+			partial += line
+			if err != io.EOF {
+				logger.Warnf("Cannot read %s: %v", file, err)
+			}
+			time.Sleep(tailInterval)
+			if rotated(f, file) {
+				if reopened, err := os.Open(file); err == nil {
+					f.Close()
+					f, partial = reopened, ""
+					reader = bufio.NewReader(f)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// rotated checks whether the file has been replaced or truncated
+func rotated(f *os.File, file string) bool {
+	current, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	latest, err := os.Stat(file)
+	if err != nil {
+		// Not recreated yet
+		return false
+	}
+	if !os.SameFile(current, latest) {
+		return true
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	return err == nil && latest.Size() < offset
+}
+
+// ListenSyslog receives syslog messages over UDP, e.g. from a router, in
+// the background and sends an event for every press found
+func (w *Watcher) ListenSyslog(address string, events chan<- Event) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 8192)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				logger.Warnf("Stopped receiving syslog messages on %s: %v", address, err)
+				return
+			}
+			if event := w.HandleLine(string(buf[:n]), time.Now()); event != nil {
+				events <- *event
+			}
+		}
+	}()
+	return nil
+}
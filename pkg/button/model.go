@@ -0,0 +1,31 @@
+package button
+
+import (
+	"net"
+	"time"
+)
+
+// Kinds of packets by which a button press is detected
+const (
+	// ARP request probing for an address, sent by Dash buttons when connecting
+	ARPProbe = "arp-probe"
+	// ARP announcing the sender's own address
+	GratuitousARP = "gratuitous-arp"
+	// DHCP DISCOVER or REQUEST, sent by newer Dash firmware and DIY buttons
+	DHCP = "dhcp"
+	// mDNS announcement, sent e.g. by ESP8266 based buttons
+	MDNS = "mdns"
+)
+
+// Kinds are all kinds of packets by which presses can be detected
+var Kinds = []string{ARPProbe, GratuitousARP, DHCP, MDNS}
+
+// Event is emitted when a button has been pressed
+type Event struct {
+	// Name under which the button has been added
+	Name string
+	MAC  net.HardwareAddr
+	Time time.Time
+	// Kind of packet by which the press was detected
+	Kind string
+}
@@ -0,0 +1,64 @@
+package button
+
+import (
+	"fmt"
+	"net"
+)
+
+// Vendors of devices likely to be used as buttons by their OUI, the
+// first three bytes of the MAC address
+var vendors = map[string]string{
+	// Amazon
+	"0c:47:c9": "Amazon",
+	"18:74:2e": "Amazon",
+	"34:d2:70": "Amazon",
+	"40:b4:cd": "Amazon",
+	"44:65:0d": "Amazon",
+	"50:f5:da": "Amazon",
+	"68:37:e9": "Amazon",
+	"68:54:fd": "Amazon",
+	"6c:56:97": "Amazon",
+	"74:75:48": "Amazon",
+	"74:c2:46": "Amazon",
+	"78:e1:03": "Amazon",
+	"84:d6:d0": "Amazon",
+	"88:71:e5": "Amazon",
+	"a0:02:dc": "Amazon",
+	"ac:63:be": "Amazon",
+	"b4:7c:9c": "Amazon",
+	"f0:27:2d": "Amazon",
+	"f0:d2:f1": "Amazon",
+	"fc:65:de": "Amazon",
+	"fc:a6:67": "Amazon",
+
+	// Espressif (ESP8266, ESP32)
+	"18:fe:34": "Espressif",
+	"24:0a:c4": "Espressif",
+	"24:62:ab": "Espressif",
+	"2c:3a:e8": "Espressif",
+	"30:ae:a4": "Espressif",
+	"3c:71:bf": "Espressif",
+	"5c:cf:7f": "Espressif",
+	"60:01:94": "Espressif",
+	"68:c6:3a": "Espressif",
+	"84:0d:8e": "Espressif",
+	"84:f3:eb": "Espressif",
+	"a0:20:a6": "Espressif",
+	"bc:dd:c2": "Espressif",
+	"cc:50:e3": "Espressif",
+	"dc:4f:22": "Espressif",
+	"ec:fa:bc": "Espressif",
+
+	// Raspberry Pi
+	"b8:27:eb": "Raspberry Pi",
+	"dc:a6:32": "Raspberry Pi",
+}
+
+// Vendor returns the vendor of a device by its MAC address or the empty
+// string if it's unknown
+func Vendor(mac net.HardwareAddr) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	return vendors[fmt.Sprintf("%02x:%02x:%02x", mac[0], mac[1], mac[2])]
+}
@@ -0,0 +1,101 @@
+package button
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Link type of Ethernet captures
+const linkTypeEthernet = 1
+
+// Larger packets are considered to be a corrupt file
+const maxPacketSize = 256 * 1024
+
+// PcapFile reads packets from a file in the classic pcap format as written
+// by tcpdump or Wireshark. It doesn't need libpcap, so that recorded button
+// presses can be replayed anywhere. Only Ethernet captures are supported.
+type PcapFile struct {
+	file   *os.File
+	reader *bufio.Reader
+	order  binary.ByteOrder
+	nanos  bool
+}
+
+// OpenPcapFile opens a pcap file and reads its header
+func OpenPcapFile(name string) (*PcapFile, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &PcapFile{
+		file:   file,
+		reader: bufio.NewReader(file),
+	}
+	if err := f.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read %s: %v", name, err)
+	}
+	return f, nil
+}
+
+func (f *PcapFile) readHeader() error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(f.reader, header); err != nil {
+		return err
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4:
+		f.order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		f.order = binary.BigEndian
+	case 0xa1b23c4d:
+		f.order, f.nanos = binary.LittleEndian, true
+	case 0x4d3cb2a1:
+		f.order, f.nanos = binary.BigEndian, true
+	default:
+		return fmt.Errorf("no pcap file (pcapng is not supported)")
+	}
+	if linkType := f.order.Uint32(header[20:]); linkType != linkTypeEthernet {
+		return fmt.Errorf("unsupported link type %d, only Ethernet captures can be read", linkType)
+	}
+	return nil
+}
+
+// ReadPacketData returns the next packet. It returns io.EOF at the end of the file
+func (f *PcapFile) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	var ci gopacket.CaptureInfo
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(f.reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated packet header")
+		}
+		return nil, ci, err
+	}
+	sec, frac := int64(f.order.Uint32(header)), int64(f.order.Uint32(header[4:]))
+	if !f.nanos {
+		frac *= int64(time.Microsecond)
+	}
+	ci.Timestamp = time.Unix(sec, frac)
+	ci.CaptureLength = int(f.order.Uint32(header[8:]))
+	ci.Length = int(f.order.Uint32(header[12:]))
+	if ci.CaptureLength > maxPacketSize {
+		return nil, ci, fmt.Errorf("invalid packet size %d", ci.CaptureLength)
+	}
+
+	data := make([]byte, ci.CaptureLength)
+	if _, err := io.ReadFull(f.reader, data); err != nil {
+		return nil, ci, fmt.Errorf("truncated packet: %v", err)
+	}
+	return data, ci, nil
+}
+
+// Close closes the file
+func (f *PcapFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,247 @@
+package button
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/rhuss/puffer/pkg/logging"
+)
+
+var logger = logging.New("button")
+
+// DefaultDebounce is the time in which further packets of a button are
+// considered to belong to the same press
+const DefaultDebounce = 5 * time.Second
+
+// DoubleDebounce is the default debounce of buttons with an action for
+// double presses. It is shorter, so that a second press soon after the
+// first one isn't taken as part of it
+const DoubleDebounce = 2 * time.Second
+
+// Watcher detects presses of any number of buttons with a single packet
+// capture. Each button has its own debounce state.
+type Watcher struct {
+	mutex   sync.Mutex
+	buttons map[string]*button
+
+	// Called for every DHCP client found in log lines, if set
+	clients func(mac net.HardwareAddr, at time.Time)
+}
+
+type button struct {
+	name       string
+	mac        net.HardwareAddr
+	debounce   time.Duration
+	kinds      map[string]bool
+	lastPushed time.Time
+}
+
+func NewWatcher() *Watcher {
+	return &Watcher{
+		buttons: map[string]*button{},
+	}
+}
+
+// ObserveClients registers a function which is called for every DHCP
+// client found in log lines, no matter whether it is a button
+func (w *Watcher) ObserveClients(observe func(mac net.HardwareAddr, at time.Time)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.clients = observe
+}
+
+// Add registers a button under a name. Presses are only detected by the given
+// kinds of packets or by all kinds if none are given. A debounce of zero
+// means DefaultDebounce
+func (w *Watcher) Add(name string, mac net.HardwareAddr, debounce time.Duration, kinds []string) error {
+	if debounce == 0 {
+		debounce = DefaultDebounce
+	}
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	kindSet := map[string]bool{}
+	for _, kind := range kinds {
+		if !isKind(kind) {
+			return fmt.Errorf("unknown kind of button packet '%s' for %s", kind, name)
+		}
+		kindSet[kind] = true
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buttons[mac.String()] = &button{
+		name:     name,
+		mac:      mac,
+		debounce: debounce,
+		kinds:    kindSet,
+	}
+	return nil
+}
+
+// Watch opens a packet capture on the interface and sends an event for every
+// press in the background. The capture is reopened if it fails.
+func (w *Watcher) Watch(iface *net.Interface, events chan<- Event) error {
+	return capture(iface, func(packet gopacket.Packet) {
+		if event := w.Handle(packet); event != nil {
+			events <- *event
+		}
+	})
+}
+
+// Read processes all packets of a source, e.g. a PcapFile, until it is
+// exhausted
+func (w *Watcher) Read(src gopacket.PacketDataSource, events chan<- Event) error {
+	for {
+		data, ci, err := src.ReadPacketData()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		packet.Metadata().CaptureInfo = ci
+		if event := w.Handle(packet); event != nil {
+			events <- *event
+		}
+	}
+}
+
+// Handle checks whether a packet is a press of one of the buttons and
+// returns the event for it, nil otherwise
+func (w *Watcher) Handle(packet gopacket.Packet) *Event {
+	mac, kind := detect(packet)
+	if mac == nil {
+		return nil
+	}
+	at := packet.Metadata().Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return w.press(mac, kind, at)
+}
+
+// press returns the event for a packet of the given kind sent by a device
+// at the given time if it's a new press of a button, nil otherwise
+func (w *Watcher) press(mac net.HardwareAddr, kind string, at time.Time) *Event {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	b, found := w.buttons[mac.String()]
+	if !found || !b.kinds[kind] {
+		return nil
+	}
+	if at.Sub(b.lastPushed) <= b.debounce {
+		return nil
+	}
+	b.lastPushed = at
+	return &Event{
+		Name: b.name,
+		MAC:  b.mac,
+		Time: at,
+		Kind: kind,
+	}
+}
+
+var zeroIP = make([]byte, 4)
+
+// detect returns the sender and the kind of a packet which a button sends
+// when it is pressed, nil if it's no such packet
+func detect(packet gopacket.Packet) (net.HardwareAddr, string) {
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		// Probes have no sender address yet, announcements (RFC 5227) have
+		// their own address as sender and target, like gratuitous ARP
+		if arp.Operation == layers.ARPRequest && bytes.Equal(arp.SourceProtAddress, zeroIP) {
+			return net.HardwareAddr(arp.SourceHwAddress), ARPProbe
+		}
+		if bytes.Equal(arp.SourceProtAddress, arp.DstProtAddress) {
+			return net.HardwareAddr(arp.SourceHwAddress), GratuitousARP
+		}
+		return nil, ""
+	}
+
+	if dhcp, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4); ok {
+		if dhcp.Operation != layers.DHCPOpRequest {
+			return nil, ""
+		}
+		for _, option := range dhcp.Options {
+			if option.Type == layers.DHCPOptMessageType && len(option.Data) == 1 {
+				msgType := layers.DHCPMsgType(option.Data[0])
+				if msgType == layers.DHCPMsgTypeDiscover || msgType == layers.DHCPMsgTypeRequest {
+					return dhcp.ClientHWAddr, DHCP
+				}
+			}
+		}
+		return nil, ""
+	}
+
+	// mDNS isn't decoded by gopacket, as it only knows port 53 for DNS
+	if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok && udp.DstPort == 5353 {
+		eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		if !ok {
+			return nil, ""
+		}
+		dns := &layers.DNS{}
+		if err := dns.DecodeFromBytes(udp.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return nil, ""
+		}
+		// Announcements are unsolicited responses
+		if dns.QR && len(dns.Answers) > 0 {
+			return eth.SrcMAC, MDNS
+		}
+	}
+	return nil, ""
+}
+
+func isKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// capture passes all packets of interest on the interface to a handler in
+// the background and reopens the capture if it fails
+func capture(iface *net.Interface, handler func(gopacket.Packet)) error {
+	handle, err := openCapture(iface.Name)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			for packet := range gopacket.NewPacketSource(handle, layers.LayerTypeEthernet).Packets() {
+				handler(packet)
+			}
+			handle.Close()
+			logger.Warnf("Packet capture on %s stopped, reopening", iface.Name)
+			for {
+				time.Sleep(5 * time.Second)
+				if handle, err = openCapture(iface.Name); err == nil {
+					break
+				}
+				logger.Warnf("Cannot reopen packet capture on %s: %v", iface.Name, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func openCapture(device string) (*pcap.Handle, error) {
+	handle, err := pcap.OpenLive(device, 65536, true, 200*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open packet capture on %s: %v", device, err)
+	}
+	if err := handle.SetBPFFilter("arp or (udp and (port 67 or port 68 or port 5353))"); err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return handle, nil
+}
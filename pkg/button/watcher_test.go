@@ -0,0 +1,140 @@
+package button
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testdata/presses.pcap holds the packets of Dash buttons pressed at
+// 07:30 UTC on 2017-03-01 and some packets which are no presses:
+//
+//	 0.0s  68:37:e9:11:22:33  ARP probe
+//	 0.5s  68:37:e9:11:22:33  ARP announcement (same press)
+//	10.0s  50:f5:da:44:55:66  gratuitous ARP reply
+//	20.0s  fc:a6:67:77:88:99  DHCP DISCOVER
+//	21.0s  c0:25:06:01:02:03  DHCP OFFER of the router (no press)
+//	21.5s  fc:a6:67:77:88:99  DHCP REQUEST (same press)
+//	30.0s  44:65:0d:aa:bb:cc  DHCP REQUEST
+//	40.0s  18:74:2e:dd:ee:ff  mDNS query (no press)
+//	41.0s  18:74:2e:dd:ee:ff  mDNS announcement
+//	50.0s  68:37:e9:11:22:33  ARP request for the router (no press)
+//	60.0s  44:65:0d:aa:bb:cc  ARP probe (only DHCP is detected for this button)
+const pressesFile = "presses.pcap"
+
+var capturedAt = time.Date(2017, 3, 1, 7, 30, 0, 0, time.UTC)
+
+// readPresses replays a capture with the given watcher and returns all events
+func readPresses(t *testing.T, w *Watcher, file string) []Event {
+	src, err := OpenPcapFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	events := make(chan Event)
+	done := make(chan []Event)
+	go func() {
+		ret := []Event{}
+		for event := range events {
+			ret = append(ret, event)
+		}
+		done <- ret
+	}()
+	err = w.Read(src, events)
+	close(events)
+	ret := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func addButton(t *testing.T, w *Watcher, name string, mac string, kinds ...string) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(name, hw, 0, kinds); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadDetectsPresses(t *testing.T) {
+	w := NewWatcher()
+	addButton(t, w, "probe", "68:37:e9:11:22:33")
+	addButton(t, w, "gratuitous", "50:f5:da:44:55:66")
+	addButton(t, w, "discover", "fc:a6:67:77:88:99")
+	addButton(t, w, "request", "44:65:0d:aa:bb:cc", DHCP)
+	addButton(t, w, "mdns", "18:74:2e:dd:ee:ff")
+	// The router sends the DHCP OFFER, which is no press
+	addButton(t, w, "router", "c0:25:06:01:02:03")
+
+	expected := []struct {
+		name   string
+		kind   string
+		offset time.Duration
+	}{
+		{"probe", ARPProbe, 0},
+		{"gratuitous", GratuitousARP, 10 * time.Second},
+		{"discover", DHCP, 20 * time.Second},
+		{"request", DHCP, 30 * time.Second},
+		{"mdns", MDNS, 41 * time.Second},
+	}
+	events := readPresses(t, w, pressesFile)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d presses, got %d: %v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Name != e.name || event.Kind != e.kind || !event.Time.Equal(capturedAt.Add(e.offset)) {
+			t.Errorf("press %d: expected %s by %s at %s, got %s by %s at %s", i,
+				e.name, e.kind, capturedAt.Add(e.offset).Format(time.StampMilli),
+				event.Name, event.Kind, event.Time.UTC().Format(time.StampMilli))
+		}
+	}
+}
+
+func TestReadRestrictsKinds(t *testing.T) {
+	w := NewWatcher()
+	addButton(t, w, "probe", "68:37:e9:11:22:33", GratuitousARP)
+	addButton(t, w, "discover", "fc:a6:67:77:88:99", MDNS, ARPProbe)
+
+	// The announcement following the probe is detected instead
+	events := readPresses(t, w, pressesFile)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 press, got %d: %v", len(events), events)
+	}
+	if events[0].Name != "probe" || events[0].Kind != GratuitousARP {
+		t.Errorf("expected gratuitous ARP of probe, got %v", events[0])
+	}
+}
+
+func TestReadDebounces(t *testing.T) {
+	w := NewWatcher()
+	hw, _ := net.ParseMAC("68:37:e9:11:22:33")
+	if err := w.Add("probe", hw, time.Minute, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The ARP request at 50s is no press, so there's only one within a minute
+	events := readPresses(t, w, pressesFile)
+	if len(events) != 1 {
+		t.Errorf("expected 1 press, got %d: %v", len(events), events)
+	}
+
+	if err := w.Add("probe", hw, time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+	events = readPresses(t, w, pressesFile)
+	if len(events) != 2 || events[1].Kind != GratuitousARP {
+		t.Errorf("expected probe and announcement as separate presses, got %v", events)
+	}
+}
+
+func TestAddRejectsUnknownKind(t *testing.T) {
+	hw, _ := net.ParseMAC("68:37:e9:11:22:33")
+	if err := NewWatcher().Add("probe", hw, 0, []string{"bluetooth"}); err == nil {
+		t.Error("unknown kind accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package calendar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	gcalendar "google.golang.org/api/calendar/v3"
+)
+
+// How long to wait for the browser to call back in the loopback flow
+const loopbackTimeout = 5 * time.Minute
+
+// LoopbackAuth authorizes the access to the calendars in the browser, which
+// redirects to a temporary server on localhost listening on the given port,
+// or on any free one for 0. prompt is called with the URL to open, which must
+// happen on this machine or one forwarding the port to it. The client secret
+// must be of type "Desktop app". Google's device flow for TVs and other
+// devices without a browser isn't an option, as it doesn't allow access to
+// calendars
+func LoopbackAuth(jsonKey []byte, port int, prompt func(authURL string)) (*oauth2.Token, error) {
+	config, err := oauthConfig(jsonKey)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	config.RedirectURL = "http://" + listener.Addr().String()
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			fmt.Fprintln(w, "Authorization failed, you can close this window.")
+			errs <- failure.New(ErrAuth, fmt.Errorf("authorization failed: %s", query.Get("error")))
+			return
+		}
+		fmt.Fprintln(w, "Authorization succeeded, you can close this window.")
+		codes <- query.Get("code")
+	}))
+
+	prompt(config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce))
+	select {
+	case code := <-codes:
+		token, err := config.Exchange(context.Background(), code)
+		if err != nil {
+			return nil, failure.New(ErrAuth, err)
+		}
+		return token, nil
+	case err := <-errs:
+		return nil, err
+	case <-time.After(loopbackTimeout):
+		return nil, failure.New(ErrAuth, fmt.Errorf("no authorization within %v", loopbackTimeout))
+	}
+}
+
+// oauthConfig reads the client secret. Unlike google.ConfigFromJSON it
+// accepts secrets without redirect URIs, which the loopback flow sets anyway
+func oauthConfig(jsonKey []byte) (*oauth2.Config, error) {
+	secret := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(jsonKey, &secret); err != nil {
+		return nil, fmt.Errorf("invalid client secret: %v", err)
+	}
+	for _, client := range secret {
+		if uris, ok := client["redirect_uris"].([]interface{}); !ok || len(uris) == 0 {
+			client["redirect_uris"] = []string{"http://localhost"}
+		}
+	}
+	patched, err := json.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+	return google.ConfigFromJSON(patched, gcalendar.CalendarReadonlyScope)
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// savingTokenSource hands out the tokens of a refreshing source and passes
+// them to save whenever they have been refreshed
+type savingTokenSource struct {
+	src  oauth2.TokenSource
+	save func(*oauth2.Token) error
+
+	mu   sync.Mutex
+	last string
+}
+
+// TokenSource returns a source of tokens for the Google calendars, which
+// refreshes the given token when it expires. Refreshed tokens are passed
+// to save so that they survive restarts
+func TokenSource(jsonKey []byte, token *oauth2.Token, save func(*oauth2.Token) error) (oauth2.TokenSource, error) {
+	config, err := oauthConfig(jsonKey)
+	if err != nil {
+		return nil, err
+	}
+	return &savingTokenSource{
+		src:  config.TokenSource(context.Background(), token),
+		save: save,
+		last: token.AccessToken,
+	}, nil
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		// The refresh token has been revoked or has expired, e.g. after
+		// six months without use
+		if strings.Contains(err.Error(), "invalid_grant") {
+			return nil, failure.New(ErrReauthorize, err)
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		if err := s.save(token); err != nil {
+			logger.Warnf("Cannot save refreshed token: %v", err)
+		}
+	}
+	return token, nil
+}
+
+// serviceAccountTokens hands out the tokens of a service account
+type serviceAccountTokens struct {
+	src oauth2.TokenSource
+}
+
+// ServiceAccountTokens returns a source of tokens for the service account
+// given by its JSON key. It can read the calendars shared with its email
+// address. With a subject it acts on behalf of this user instead, which
+// needs domain-wide delegation in Google Workspace
+func ServiceAccountTokens(jsonKey []byte, subject string) (oauth2.TokenSource, error) {
+	config, err := google.JWTConfigFromJSON(jsonKey, gcalendar.CalendarReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %v", err)
+	}
+	config.Subject = subject
+	return &serviceAccountTokens{config.TokenSource(context.Background())}, nil
+}
+
+func (s *serviceAccountTokens) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		// E.g. a disabled key or missing delegation for the subject
+		return nil, failure.New(ErrAuth, err)
+	}
+	return token, nil
+}
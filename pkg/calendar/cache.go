@@ -0,0 +1,275 @@
+package calendar
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+)
+
+// syncer is a provider whose events can be copied and updated incrementally
+type syncer interface {
+	Provider
+	// cacheKey identifies the calendar among all others
+	cacheKey() string
+	// sync updates the state of the last sync, which is empty for the
+	// first one. The state is left untouched if syncing fails
+	sync(state *syncState, now time.Time) error
+}
+
+// How many days ahead the events of CalDAV and Google calendars are copied
+const cacheDays = 62
+
+// syncState is the copy of a calendar
+type syncState struct {
+	// When the copy has been synced successfully the last time
+	Synced time.Time
+	// Version of the copy as known by the calendar service: The sync token of
+	// Google calendars or the ETag (or modification time) of iCalendar feeds
+	Token    string `json:",omitempty"`
+	Modified string `json:",omitempty"`
+	// Time range of the events copied, zero for no limit
+	Start time.Time
+	End   time.Time
+	// The events by their ID or URL
+	Entries map[string]*entry
+}
+
+// entry is a single event or a whole feed, given either by items or by iCalendar data
+type entry struct {
+	ETag  string `json:",omitempty"`
+	Items []Item `json:",omitempty"`
+	Data  string `json:",omitempty"`
+
+	// Data parsed
+	events []*vevent
+}
+
+// Cache keeps copies of calendars in memory and in a directory, so that their
+// events are at hand without asking the calendar services. The copies are
+// synced incrementally, using sync tokens for Google calendars and ETags for
+// CalDAV calendars and iCalendar feeds
+type Cache struct {
+	dir string
+	// Copies older than this are synced before their events are used
+	maxAge time.Duration
+	// How long copies are used while the calendar services are unavailable
+	offline time.Duration
+
+	mu        sync.Mutex
+	calendars map[string]*cachedCalendar
+}
+
+// NewCache creates a cache keeping its copies in the given directory
+func NewCache(dir string, maxAge time.Duration, offline time.Duration) *Cache {
+	return &Cache{
+		dir:       dir,
+		maxAge:    maxAge,
+		offline:   offline,
+		calendars: map[string]*cachedCalendar{},
+	}
+}
+
+// Cached returns a provider answering from the copy of the calendar. Providers
+// which can't be copied are returned as they are
+func (c *Cache) Cached(provider Provider) Provider {
+	s, ok := provider.(syncer)
+	if !ok {
+		return provider
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := s.cacheKey()
+	cached, found := c.calendars[key]
+	if !found {
+		sum := sha1.Sum([]byte(key))
+		cached = &cachedCalendar{
+			cache: c,
+			file:  filepath.Join(c.dir, hex.EncodeToString(sum[:8])+".json"),
+		}
+		c.calendars[key] = cached
+	}
+	cached.setProvider(s)
+	return cached
+}
+
+// Sync updates the copies of all calendars returned by Cached so far
+func (c *Cache) Sync() {
+	c.mu.Lock()
+	calendars := []*cachedCalendar{}
+	for _, cached := range c.calendars {
+		calendars = append(calendars, cached)
+	}
+	c.mu.Unlock()
+
+	for _, cached := range calendars {
+		if err := cached.update(time.Now()); err != nil {
+			logger.Warnf("Cannot sync calendar %s: %v", cached.Name(), err)
+		}
+	}
+}
+
+// cachedCalendar is a calendar answering from its copy
+type cachedCalendar struct {
+	cache *Cache
+	file  string
+
+	mu       sync.Mutex
+	provider syncer
+	// nil until loaded
+	state *syncState
+	// Last failure of syncing and when it happened. Syncing isn't retried
+	// before the copy is due again, so that unreachable services don't
+	// delay every request
+	failure error
+	failed  time.Time
+}
+
+func (c *cachedCalendar) setProvider(provider syncer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.provider = provider
+}
+
+func (c *cachedCalendar) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provider.Name()
+}
+
+// Items answers from the copy, which is synced first if it is too old. If the
+// calendar service is unavailable, the copy is used for a while nevertheless.
+// Windows not covered by the copy are fetched from the calendar service
+func (c *cachedCalendar) Items(start time.Time, end time.Time) ([]Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.load()
+	if now.Sub(c.state.Synced) >= c.cache.maxAge {
+		err := c.failure
+		retry := now.Sub(c.failed) >= c.cache.maxAge
+		if retry {
+			err = c.sync(now)
+		}
+		if err != nil {
+			if failure.Kind(classify(err)) != ErrBackendUnavailable || c.state.Synced.IsZero() || now.Sub(c.state.Synced) > c.cache.offline {
+				return nil, err
+			}
+			if retry {
+				logger.Warnf("Using copy of calendar %s from %s: %v", c.provider.Name(), c.state.Synced.Format(time.RFC3339), err)
+			}
+		}
+	}
+	if !c.state.covers(start, end) {
+		return c.provider.Items(start, end)
+	}
+	return c.state.items(start, end)
+}
+
+// update syncs the copy
+func (c *cachedCalendar) update(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	return c.sync(now)
+}
+
+// sync syncs the copy and saves it. Must be called with the lock held
+func (c *cachedCalendar) sync(now time.Time) error {
+	state := *c.state
+	if err := c.provider.sync(&state, now); err != nil {
+		c.failure, c.failed = err, now
+		return err
+	}
+	c.failure = nil
+	state.Synced = now
+	state.prune(midnight(now))
+	c.state = &state
+	if err := c.save(); err != nil {
+		logger.Warnf("Cannot save copy of calendar %s: %v", c.provider.Name(), err)
+	}
+	return nil
+}
+
+// load reads the copy saved before, if not done yet. Must be called with the lock held
+func (c *cachedCalendar) load() {
+	if c.state != nil {
+		return
+	}
+	c.state = &syncState{}
+	data, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Cannot read copy of calendar %s: %v", c.provider.Name(), err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, c.state); err != nil {
+		logger.Warnf("Ignoring invalid copy of calendar %s in %s: %v", c.provider.Name(), c.file, err)
+		c.state = &syncState{}
+	}
+}
+
+// save writes the copy, which is only readable by the owner as it may
+// contain private events. Must be called with the lock held
+func (c *cachedCalendar) save() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.cache.dir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.file, data, 0600)
+}
+
+// covers checks whether the copy contains all events of the window
+func (s *syncState) covers(start time.Time, end time.Time) bool {
+	return (s.Start.IsZero() || !start.Before(s.Start)) && (s.End.IsZero() || !end.After(s.End))
+}
+
+// items returns the copied events overlapping the window
+func (s *syncState) items(start time.Time, end time.Time) ([]Item, error) {
+	ret := []Item{}
+	events := []*vevent{}
+	for _, e := range s.Entries {
+		for _, item := range e.Items {
+			if overlaps(item, start, end) {
+				ret = append(ret, item)
+			}
+		}
+		if e.Data != "" && e.events == nil {
+			parsed, err := parseICS(strings.NewReader(e.Data))
+			if err != nil {
+				return nil, err
+			}
+			e.events = parsed
+		}
+		events = append(events, e.events...)
+	}
+	return append(ret, expandEvents(events, start, end)...), nil
+}
+
+// prune drops the copied events which are over before the given time
+func (s *syncState) prune(before time.Time) {
+	if s.Start.IsZero() || !s.Start.Before(before) {
+		return
+	}
+	for id, e := range s.Entries {
+		over := len(e.Items) > 0
+		for _, item := range e.Items {
+			over = over && !item.End.After(before)
+		}
+		if over {
+			delete(s.Entries, id)
+		}
+	}
+	s.Start = before
+}
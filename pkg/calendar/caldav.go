@@ -0,0 +1,196 @@
+package calendar
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+)
+
+// Query for all events within a time range. Recurring events are expanded
+// locally, as not all servers support <C:expand>
+const calendarQuery = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+// Query for the ETags of the events within a time range
+const etagQuery = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+// Query for the events given by their hrefs
+const multigetQuery = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+  %s
+</C:calendar-multiget>`
+
+// Format of times in CalDAV time ranges
+const caldavTime = "20060102T150405Z"
+
+// caldavCalendar is a calendar collection on a CalDAV server like Nextcloud
+type caldavCalendar struct {
+	name     string
+	url      string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// multistatus is the answer of a calendar-query REPORT
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status       string `xml:"status"`
+			ETag         string `xml:"prop>getetag"`
+			CalendarData string `xml:"prop>calendar-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// NewCalDAVProvider creates a provider for the calendar collection at the
+// given URL, e.g. "https://cloud.example.com/remote.php/dav/calendars/roland/family/"
+func NewCalDAVProvider(name string, url string, user string, password string) Provider {
+	return &caldavCalendar{
+		name:     name,
+		url:      url,
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *caldavCalendar) Name() string {
+	return c.name
+}
+
+func (c *caldavCalendar) Items(start time.Time, end time.Time) ([]Item, error) {
+	result, err := c.report(fmt.Sprintf(calendarQuery, start.UTC().Format(caldavTime), end.UTC().Format(caldavTime)))
+	if err != nil {
+		return nil, err
+	}
+	events := []*vevent{}
+	for _, r := range result.Responses {
+		for _, propstat := range r.Propstat {
+			if propstat.CalendarData == "" || !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			e, err := parseICS(strings.NewReader(propstat.CalendarData))
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %s of calendar %s: %v", r.Href, c.name, err)
+			}
+			events = append(events, e...)
+		}
+	}
+	return expandEvents(events, start, end), nil
+}
+
+// report sends a REPORT request with the query and decodes the answer
+func (c *caldavCalendar) report(query string) (*multistatus, error) {
+	req, err := http.NewRequest("REPORT", c.url, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, failure.New(ErrBackendUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, c.name); err != nil {
+		return nil, err
+	}
+
+	result := &multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, failure.New(ErrBackendUnavailable, fmt.Errorf("invalid answer for calendar %s: %v", c.name, err))
+	}
+	return result, nil
+}
+
+func (c *caldavCalendar) cacheKey() string {
+	return "caldav/" + c.url
+}
+
+// sync lists the ETags of the events of the next two months and fetches
+// only those events which are new or have changed since the last sync
+func (c *caldavCalendar) sync(state *syncState, now time.Time) error {
+	start := midnight(now)
+	end := start.AddDate(0, 0, cacheDays)
+	listing, err := c.report(fmt.Sprintf(etagQuery, start.UTC().Format(caldavTime), end.UTC().Format(caldavTime)))
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]*entry{}
+	hrefs := ""
+	fetched := 0
+	for _, r := range listing.Responses {
+		for _, propstat := range r.Propstat {
+			if propstat.ETag == "" || !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			if e, found := state.Entries[r.Href]; found && e.ETag == propstat.ETag {
+				entries[r.Href] = e
+			} else {
+				hrefs += "<D:href>" + html.EscapeString(r.Href) + "</D:href>"
+				fetched++
+			}
+		}
+	}
+	if hrefs != "" {
+		changed, err := c.report(fmt.Sprintf(multigetQuery, hrefs))
+		if err != nil {
+			return err
+		}
+		for _, r := range changed.Responses {
+			for _, propstat := range r.Propstat {
+				if propstat.CalendarData == "" || !strings.Contains(propstat.Status, " 200 ") {
+					continue
+				}
+				events, err := parseICS(strings.NewReader(propstat.CalendarData))
+				if err != nil {
+					return fmt.Errorf("cannot parse %s of calendar %s: %v", r.Href, c.name, err)
+				}
+				entries[r.Href] = &entry{ETag: propstat.ETag, Data: propstat.CalendarData, events: events}
+			}
+		}
+	}
+	logger.Debugf("Synced calendar %s: %d events, %d fetched", c.name, len(entries), fetched)
+	state.Entries = entries
+	state.Start, state.End = start, end
+	return nil
+}
@@ -0,0 +1,180 @@
+package calendar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+)
+
+var hrefPattern = regexp.MustCompile(`<D:href>([^<]+)</D:href>`)
+
+// caldavServer is a CalDAV server answering REPORT requests for a single
+// calendar collection
+type caldavServer struct {
+	// The events by their href
+	events map[string]caldavEvent
+	// The hrefs requested by the last calendar-multiget
+	fetched []string
+}
+
+type caldavEvent struct {
+	etag string
+	data string
+}
+
+func (s *caldavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "roland" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "REPORT" || r.URL.Path != "/calendars/roland/family/" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	query := string(body)
+
+	hrefs := []string{}
+	if strings.Contains(query, "calendar-multiget") {
+		s.fetched = []string{}
+		for _, m := range hrefPattern.FindAllStringSubmatch(query, -1) {
+			hrefs = append(hrefs, m[1])
+			s.fetched = append(s.fetched, m[1])
+		}
+	} else {
+		for href := range s.events {
+			hrefs = append(hrefs, href)
+		}
+		sort.Strings(hrefs)
+	}
+	withData := strings.Contains(query, "<C:calendar-data/>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(207)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">`)
+	for _, href := range hrefs {
+		event, found := s.events[href]
+		if !found {
+			fmt.Fprintf(w, "<d:response><d:href>%s</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>", href)
+			continue
+		}
+		data := ""
+		if withData {
+			data = "<cal:calendar-data>" + event.data + "</cal:calendar-data>"
+		}
+		fmt.Fprintf(w, "<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag>%s</d:prop>"+
+			"<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>", href, event.etag, data)
+	}
+	fmt.Fprint(w, "</d:multistatus>")
+}
+
+// caldavData returns an iCalendar object with a single event of an hour
+// and the given extra properties
+func caldavData(uid string, summary string, start string, props ...string) string {
+	extra := ""
+	for _, prop := range props {
+		extra += prop + "\r\n"
+	}
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + summary +
+		"\r\nDTSTART:" + start + "\r\nDURATION:PT1H\r\n" + extra + "END:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func newCaldavServer() (*caldavServer, *httptest.Server) {
+	s := &caldavServer{events: map[string]caldavEvent{
+		"/calendars/roland/family/dentist.ics": {`"1"`, caldavData("dentist", "Zahnarzt", "20170308T080000Z")},
+		"/calendars/roland/family/choir.ics":   {`"1"`, caldavData("choir", "Chor", "20170302T183000Z", "RRULE:FREQ=WEEKLY")},
+	}}
+	return s, httptest.NewServer(s)
+}
+
+func summaries(items []Item) string {
+	ret := []string{}
+	for _, item := range items {
+		ret = append(ret, item.Summary+" "+item.Start.UTC().Format("01-02 15:04"))
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ", ")
+}
+
+func TestCalDAVItems(t *testing.T) {
+	_, server := newCaldavServer()
+	defer server.Close()
+	provider := NewCalDAVProvider("family", server.URL+"/calendars/roland/family/", "roland", "secret")
+
+	start := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	items, err := provider.Items(start, start.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Chor 03-02 18:30, Chor 03-09 18:30, Zahnarzt 03-08 08:00"
+	if s := summaries(items); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+}
+
+func TestCalDAVAuth(t *testing.T) {
+	_, server := newCaldavServer()
+	defer server.Close()
+	provider := NewCalDAVProvider("family", server.URL+"/calendars/roland/family/", "roland", "wrong")
+
+	_, err := provider.Items(time.Now(), time.Now().Add(time.Hour))
+	if failure.Kind(err) != ErrAuth {
+		t.Errorf("expected authorization error, got %v", err)
+	}
+}
+
+func TestCalDAVSync(t *testing.T) {
+	s, server := newCaldavServer()
+	defer server.Close()
+	provider := NewCalDAVProvider("family", server.URL+"/calendars/roland/family/", "roland", "secret").(*caldavCalendar)
+
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	state := &syncState{}
+	if err := provider.sync(state, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.fetched) != 2 || len(state.Entries) != 2 {
+		t.Fatalf("expected all events fetched, got %v and %d entries", s.fetched, len(state.Entries))
+	}
+	if !state.covers(midnight(now), midnight(now).AddDate(0, 0, cacheDays)) {
+		t.Errorf("unexpected window %v - %v", state.Start, state.End)
+	}
+
+	// Only the changed and the new event are fetched, the deleted one is dropped
+	s.events["/calendars/roland/family/dentist.ics"] = caldavEvent{`"2"`, caldavData("dentist", "Zahnarzt", "20170308T090000Z")}
+	s.events["/calendars/roland/family/school.ics"] = caldavEvent{`"1"`, caldavData("school", "Elternabend", "20170307T180000Z")}
+	delete(s.events, "/calendars/roland/family/choir.ics")
+	if err := provider.sync(state, now); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(s.fetched)
+	if strings.Join(s.fetched, " ") != "/calendars/roland/family/dentist.ics /calendars/roland/family/school.ics" {
+		t.Errorf("unexpected events fetched: %v", s.fetched)
+	}
+	items, err := state.items(now, now.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Elternabend 03-07 18:00, Zahnarzt 03-08 09:00"
+	if s := summaries(items); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+
+	// Nothing is fetched without changes
+	s.fetched = nil
+	if err := provider.sync(state, now); err != nil {
+		t.Fatal(err)
+	}
+	if s.fetched != nil {
+		t.Errorf("unchanged events fetched: %v", s.fetched)
+	}
+}
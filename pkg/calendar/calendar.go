@@ -2,21 +2,18 @@ package calendar
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
-	"golang.org/x/net/context"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	gcalendar "google.golang.org/api/calendar/v3"
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/logging"
+	"google.golang.org/api/googleapi"
 	"sort"
-	"log"
 )
 
-// helper for extracting calendar data
-type calendarItem struct {
-	id   string
-	name string
-}
+var logger = logging.New("calendar")
 
 type ByStart []TimedEvent
 
@@ -24,200 +21,243 @@ func (a ByStart) Len() int           { return len(a) }
 func (a ByStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByStart) Less(i, j int) bool { return a[i].Start.Unix() < a[j].Start.Unix() }
 
-// FetchToken reaches out to Google OAuth with the clients credentials to get a valid token
-// Interactive user action is required here
-func FetchToken(jsonKey []byte) (*oauth2.Token, error) {
-	config, err := google.ConfigFromJSON(jsonKey, gcalendar.CalendarReadonlyScope)
+// GetNextEvents fetches the events from today (or tomorrow if none are there for today)
+// including those still running, and the all-day events of today and tomorrow. All-day
+// events are taken from both the today and the allDay calendars
+func GetNextEvents(today []Provider, allDay []Provider) (*NextEvents, error) {
+	return getNextEvents(today, allDay, time.Now())
+}
+
+func getNextEvents(today []Provider, allDay []Provider, now time.Time) (*NextEvents, error) {
+	start, tonight, end := getTimeWindow(now)
+	logger.Debugf("Start: %v Midnight: %v End: %v", start.Format(time.RFC3339), tonight, end)
+
+	timed, err := collect(today, start, end, false)
 	if err != nil {
 		return nil, err
 	}
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+"authorization code: \n%v\n", authURL)
-
-	var code string
-	if _, err := fmt.Scan(&code); err != nil {
-		return nil, err
+	var ongoing, todays, tomorrows []TimedEvent
+	for _, e := range timed {
+		switch {
+		case e.Start.Before(start):
+			e.Event = withSpan(e, midnight(start))
+			ongoing = append(ongoing, e)
+		case e.Start.Before(tonight):
+			todays = append(todays, e)
+		default:
+			tomorrows = append(tomorrows, e)
+		}
+	}
+	if len(todays) > 0 {
+		tomorrows = nil
 	}
 
-	tok, err := config.Exchange(context.TODO(), code)
+	allDays, err := collect(append(append([]Provider{}, today...), allDay...), midnight(start), end, true)
 	if err != nil {
 		return nil, err
 	}
-	return tok, nil
-}
+	var todayAllDays, tomorrowAllDays []Event
+	for _, e := range allDays {
+		if e.Start.Before(tonight) {
+			todayAllDays = append(todayAllDays, withSpan(e, midnight(start)))
+		}
+		if e.End.After(tonight) {
+			tomorrowAllDays = append(tomorrowAllDays, withSpan(e, tonight))
+		}
+	}
 
-// CloseEvent fetches the events from today (or tomorrow if none are there for today)
-func GetNextEvents(oauthToken *oauth2.Token, jsonKey []byte, todayCalendarNames []string, allDayCalendarNames [] string) (*NextEvents, error) {
-	ctx := context.Background()
+	return &NextEvents{
+		OngoingEvents:        timedOrNil(ongoing),
+		TodayEvents:          timedOrNil(todays),
+		TomorrowEvents:       timedOrNil(tomorrows),
+		TodayAllDayEvents:    eventsOrNil(todayAllDays),
+		TomorrowAllDayEvents: eventsOrNil(tomorrowAllDays),
+	}, nil
+}
 
-	config, err := google.ConfigFromJSON(jsonKey, gcalendar.CalendarReadonlyScope)
-	if err != nil {
-		return nil, err
+func timedOrNil(events []TimedEvent) *[]TimedEvent {
+	if len(events) == 0 {
+		return nil
 	}
-	client := config.Client(ctx, oauthToken)
+	return &events
+}
 
-	srv, err := gcalendar.New(client)
-	if err != nil {
-		return nil, err
+func eventsOrNil(events []Event) *[]Event {
+	if len(events) == 0 {
+		return nil
 	}
+	return &events
+}
 
-	calendars, err := getCalendarIds(srv, todayCalendarNames)
-	if err != nil {
-		return nil, err
+// withSpan returns the event with the number of the given day and the
+// number of days set if it lasts several days
+func withSpan(e TimedEvent, day time.Time) Event {
+	event := e.Event
+	last := e.End.Add(-time.Nanosecond)
+	if e.End.Equal(*e.Start) {
+		last = *e.Start
+	}
+	if days := daysBetween(*e.Start, last) + 1; days > 1 {
+		event.Day = daysBetween(*e.Start, day) + 1
+		event.Days = days
 	}
-	log.Printf("Calendars: %v", calendars)
+	return event
+}
 
-	start, midnight, end := getTimeWindow()
-	log.Printf("Start: %v Midnight: %v End: %v",start.Format(time.RFC3339), midnight, end)
+// daysBetween returns the number of days from the day of a to the day of b
+func daysBetween(a time.Time, b time.Time) int {
+	return int(midnight(b).Sub(midnight(a)).Hours()/24 + 0.5)
+}
 
-	todayEvents, err := extractEventsForCalendars(srv, calendars, start, midnight)
-	if err != nil {
-		return nil, err
-	}
-	var tomorrowEvents *[]TimedEvent
-	if len(*todayEvents) == 0 {
-		todayEvents = nil
-		tomorrowEvents, err = extractEventsForCalendars(srv, calendars, start, end)
-		if err != nil {
-			return nil, err
-		}
-		if len(*tomorrowEvents) == 0 {
-			tomorrowEvents = nil
-		}
-	}
+// GetAllDayEvents fetches the all-day events of the given day
+func GetAllDayEvents(providers []Provider, day time.Time) (*[]Event, error) {
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, 0, 0, 0, 0, day.Location())
+	return allDayEvents(providers, start, start.AddDate(0, 0, 1))
+}
 
-	allDayCalendars, err := getCalendarIds(srv, allDayCalendarNames)
+// GetEvents fetches the timed events of the providers in today and the all-day
+// events of the providers in both lists within the window, grouped by day. Timed
+// events are put on the day they start or, if already running, on the first day.
+// All-day events are put on every day they last. Days without events are left out
+func GetEvents(today []Provider, allDay []Provider, w Window) ([]Day, error) {
+	logger.Debugf("Window: %v - %v", w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339))
+	timed, err := collect(today, w.Start, w.End, false)
 	if err != nil {
 		return nil, err
 	}
-
-	tomorrowAllDayEvents, err := extractAllDayEvents(srv, allDayCalendars, midnight, end)
+	allDays, err := collect(append(append([]Provider{}, today...), allDay...), w.Start, w.End, true)
 	if err != nil {
 		return nil, err
 	}
 
-	return &NextEvents{
-		TodayEvents:    todayEvents,
-		TomorrowEvents: tomorrowEvents,
-		TomorrowAllDayEvents: tomorrowAllDayEvents,
-	}, nil
-}
-func extractAllDayEvents(srv *gcalendar.Service, calendars []calendarItem, start time.Time, end time.Time) (*[]Event, error) {
-	ret := []Event{}
-	for _, cal := range calendars {
-		events, err := getEvents(srv, cal, start, end)
-		if err != nil {
-			return nil, err
-		}
-
-		if len(events.Items) > 0 {
-			for _, i := range events.Items {
-				// If the DateTime is an empty string the Event is an all-day Event.
-				// So only Date is available.
-				if i.Start.DateTime == "" {
-					event := Event{
-						Calendar: cal.name,
-						Summary:  i.Summary,
-					}
-					ret = append(ret, event)
-				}
+	days := []Day{}
+	dayAt := func(date time.Time) *Day {
+		for i := range days {
+			if days[i].Date.Equal(date) {
+				return &days[i]
 			}
 		}
+		days = append(days, Day{Date: date})
+		return &days[len(days)-1]
 	}
-	if len(ret) == 0 {
-		return nil, nil
-	} else {
-		return &ret, nil
-	}
-}
-
-func extractEventsForCalendars(srv *gcalendar.Service, calendars []calendarItem, start time.Time, end time.Time) (*[]TimedEvent, error) {
-	ret := []TimedEvent{}
-	for _, cal := range calendars {
-		events, err := getEvents(srv, cal, start, end)
-		if err != nil {
-			return nil, err
-		}
-		e, err := extractTimedEvents(cal, events)
-		if err != nil {
-			return nil, err
+	for _, e := range allDays {
+		for date := midnight(*e.Start); date.Before(*e.End) && date.Before(w.End); date = date.AddDate(0, 0, 1) {
+			if date.AddDate(0, 0, 1).After(w.Start) {
+				day := dayAt(date)
+				day.AllDay = append(day.AllDay, withSpan(e, date))
+			}
 		}
-		ret = append(ret, *e...)
 	}
-	sort.Sort(ByStart(ret))
-	return &ret, nil
-}
-
-func extractTimedEvents(cal calendarItem, events *gcalendar.Events) (*[]TimedEvent, error) {
-	ret := []TimedEvent{}
-	if len(events.Items) > 0 {
-		for _, i := range events.Items {
-			// If the DateTime is an empty string the Event is an all-day Event.
-			// So only Date is available.
-			if i.Start.DateTime != "" {
-				startTime, err := parseRfc339(i.Start.DateTime)
-				if err != nil {
-					return nil, err
-				}
-				endTime, err := parseRfc339(i.End.DateTime)
-				if err != nil {
-					return nil, err
-				}
-				event := TimedEvent{
-					Start:     startTime,
-					End:       endTime,
-					Event: Event{
-						Calendar: cal.name,
-						Summary:  i.Summary,
-					},
-				}
-				ret = append(ret, event)
-			}
+	for _, e := range timed {
+		if e.Start.Before(w.Start) {
+			day := dayAt(midnight(w.Start))
+			e.Event = withSpan(e, day.Date)
+			day.Ongoing = append(day.Ongoing, e)
+			continue
 		}
+		day := dayAt(midnight(*e.Start))
+		day.Timed = append(day.Timed, e)
 	}
-	return &ret, nil
+	sort.Sort(byDate(days))
+	return days, nil
 }
 
-func getEvents(srv *gcalendar.Service, cal calendarItem, start time.Time, end time.Time) (*gcalendar.Events, error) {
-	events, err := srv.Events.List(cal.id).ShowDeleted(false).
-		SingleEvents(true).TimeMin(start.Format(time.RFC3339)).TimeMax(end.Format(time.RFC3339)).OrderBy("startTime").Do()
-	return events, err
+// GetTimedEvents fetches the events with a time of day within the window, sorted by start
+func GetTimedEvents(providers []Provider, start time.Time, end time.Time) ([]TimedEvent, error) {
+	return collect(providers, start, end, false)
 }
 
-func getCalendarIds(srv *gcalendar.Service, summaries []string) ([]calendarItem, error) {
-	cl, err := srv.CalendarList.List().Do()
-	if err != nil {
+// allDayEvents returns the all-day events within the window or nil if there are none
+func allDayEvents(providers []Provider, start time.Time, end time.Time) (*[]Event, error) {
+	events, err := collect(providers, start, end, true)
+	if err != nil || len(events) == 0 {
 		return nil, err
 	}
-	ret := []calendarItem{}
+	ret := []Event{}
+	for _, e := range events {
+		ret = append(ret, e.Event)
+	}
+	return &ret, nil
+}
 
-	for _, i := range cl.Items {
-		for _, j := range summaries {
-			if j == i.Summary {
-				ret = append(ret, calendarItem{
-					id:   i.Id,
-					name: i.Summary,
-				})
+// collect returns either the all-day or the timed events of the providers
+// within the window, sorted by start. Events contained in several calendars,
+// e.g. when given in both lists, are returned only once. Timed events are
+// given in local time, as they are announced in it, all-day events keep
+// their dates
+func collect(providers []Provider, start time.Time, end time.Time, allDay bool) ([]TimedEvent, error) {
+	ret := []TimedEvent{}
+	seen := map[string]bool{}
+	for _, p := range providers {
+		items, err := p.Items(start, end)
+		if err != nil {
+			return nil, classify(err)
+		}
+		for _, item := range items {
+			key := fmt.Sprintf("%s/%d/%d", item.Summary, item.Start.Unix(), item.End.Unix())
+			if item.AllDay != allDay || seen[key] {
+				continue
+			}
+			seen[key] = true
+			startTime, endTime := item.Start, item.End
+			if !allDay {
+				startTime, endTime = startTime.In(time.Local), endTime.In(time.Local)
 			}
+			ret = append(ret, TimedEvent{
+				Start: &startTime,
+				End:   &endTime,
+				Event: Event{
+					Calendar:    p.Name(),
+					Summary:     item.Summary,
+					Masked:      item.Masked,
+					Location:    item.Location,
+					Description: item.Description,
+					Attendees:   item.Attendees,
+					Reminders:   item.Reminders,
+				},
+			})
 		}
 	}
+	sort.Sort(ByStart(ret))
 	return ret, nil
 }
 
-func parseRfc339(rfc3339 string) (*time.Time, error) {
-	t, err := time.Parse(time.RFC3339, rfc3339)
-	if err != nil {
-		return nil, err
+// classify turns failures of the calendar services into an *Error
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	// Failures of the token source are wrapped by the HTTP client
+	if e, ok := err.(*url.Error); ok {
+		if cause, ok := e.Err.(*failure.Error); ok {
+			return cause
+		}
+	}
+	switch e := err.(type) {
+	case *failure.Error:
+		return err
+	case *googleapi.Error:
+		if e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden {
+			return failure.New(ErrAuth, err)
+		}
+		return failure.New(ErrBackendUnavailable, err)
+	}
+	// Refreshing the token failed, e.g. because it has been revoked
+	if strings.Contains(err.Error(), "oauth2: cannot fetch token") {
+		return failure.New(ErrAuth, err)
+	}
+	if _, ok := err.(*url.Error); ok {
+		return failure.New(ErrBackendUnavailable, err)
 	}
-	return &t, nil
+	return err
 }
 
 // Get the time window for which to fetch events
-func getTimeWindow() (time.Time, time.Time, time.Time) {
-	start := time.Now()
+func getTimeWindow(start time.Time) (time.Time, time.Time, time.Time) {
 	year, month, day := start.Date()
 	lastMidnight := time.Date(year, month, day, 0, 0, 0, 0, start.Location())
-	midnight := lastMidnight.Add(time.Hour * 24)
-	end := lastMidnight.Add(2 * time.Hour * 24)
+	midnight := lastMidnight.AddDate(0, 0, 1)
+	end := lastMidnight.AddDate(0, 0, 2)
 	return start, midnight, end
 }
@@ -0,0 +1,185 @@
+package calendar
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fixedCalendar is a calendar with fixed items, of which those within the
+// requested window are returned
+type fixedCalendar []Item
+
+func (c fixedCalendar) Name() string {
+	return "Familie"
+}
+
+func (c fixedCalendar) Items(start time.Time, end time.Time) ([]Item, error) {
+	ret := []Item{}
+	for _, item := range c {
+		if item.Start.Before(end) && item.End.After(start) {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
+
+func timedEvent(start time.Time, end time.Time) TimedEvent {
+	return TimedEvent{Start: &start, End: &end}
+}
+
+func TestWithSpan(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	// March 6th 2017 is a Monday
+	at := func(day int, hour int) time.Time {
+		return time.Date(2017, 3, day, hour, 0, 0, 0, time.Local)
+	}
+	inBerlin := func(month time.Month, day int) time.Time {
+		return time.Date(2017, month, day, 0, 0, 0, 0, berlin)
+	}
+	for _, c := range []struct {
+		name  string
+		event TimedEvent
+		day   time.Time
+		span  [2]int
+	}{
+		{"hour", timedEvent(at(6, 9), at(6, 10)), at(6, 0), [2]int{0, 0}},
+		{"no duration", timedEvent(at(6, 0), at(6, 0)), at(6, 0), [2]int{0, 0}},
+		// All-day events end at midnight of the day after
+		{"all day", timedEvent(at(6, 0), at(7, 0)), at(6, 0), [2]int{0, 0}},
+		{"three days", timedEvent(at(6, 0), at(9, 0)), at(6, 0), [2]int{1, 3}},
+		{"three days", timedEvent(at(6, 0), at(9, 0)), at(7, 0), [2]int{2, 3}},
+		{"three days", timedEvent(at(6, 0), at(9, 0)), at(8, 0), [2]int{3, 3}},
+		{"until midnight", timedEvent(at(6, 20), at(7, 0)), at(6, 0), [2]int{0, 0}},
+		{"over night", timedEvent(at(6, 22), at(7, 2)), at(7, 0), [2]int{2, 2}},
+		{"over night", timedEvent(at(6, 22), at(7, 2)), at(6, 0), [2]int{1, 2}},
+		// Days of 23 and 25 hours
+		{"spring", timedEvent(inBerlin(3, 25), inBerlin(3, 28)), inBerlin(3, 27), [2]int{3, 3}},
+		{"autumn", timedEvent(inBerlin(10, 28), inBerlin(10, 31)), inBerlin(10, 30), [2]int{3, 3}},
+		{"autumn", timedEvent(inBerlin(10, 29), inBerlin(10, 30)), inBerlin(10, 29), [2]int{0, 0}},
+	} {
+		event := withSpan(c.event, c.day)
+		if span := [2]int{event.Day, event.Days}; span != c.span {
+			t.Errorf("%s on %s: expected day %d of %d, got %d of %d", c.name, c.day.Format("01-02"), c.span[0], c.span[1], span[0], span[1])
+		}
+	}
+}
+
+func TestGetNextEvents(t *testing.T) {
+	// Tuesday
+	now := time.Date(2017, 3, 7, 10, 0, 0, 0, time.Local)
+	at := func(day int, hour int) time.Time {
+		return time.Date(2017, 3, day, hour, 0, 0, 0, time.Local)
+	}
+	provider := fixedCalendar{
+		{Summary: "Konferenz", Start: at(6, 9), End: at(8, 17)},
+		{Summary: "Besprechung", Start: at(7, 9), End: at(7, 11)},
+		{Summary: "Zahnarzt", Start: at(7, 14), End: at(7, 15)},
+		{Summary: "Chor", Start: at(8, 19), End: at(8, 21)},
+		{Summary: "Urlaub", Start: at(6, 0), End: at(9, 0), AllDay: true},
+		{Summary: "Müllabfuhr", Start: at(7, 0), End: at(8, 0), AllDay: true},
+		{Summary: "Geburtstag", Start: at(8, 0), End: at(9, 0), AllDay: true},
+	}
+	events, err := getNextEvents([]Provider{provider}, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if events.OngoingEvents == nil || len(*events.OngoingEvents) != 2 {
+		t.Fatalf("unexpected ongoing events %v", events.OngoingEvents)
+	}
+	for i, expected := range []struct {
+		summary string
+		day     int
+		days    int
+	}{
+		{"Konferenz", 2, 3},
+		{"Besprechung", 0, 0},
+	} {
+		e := (*events.OngoingEvents)[i]
+		if e.Summary != expected.summary || e.Day != expected.day || e.Days != expected.days {
+			t.Errorf("expected %s day %d of %d, got %s day %d of %d", expected.summary, expected.day, expected.days, e.Summary, e.Day, e.Days)
+		}
+	}
+	if events.TodayEvents == nil || len(*events.TodayEvents) != 1 || (*events.TodayEvents)[0].Summary != "Zahnarzt" {
+		t.Errorf("unexpected events today %v", events.TodayEvents)
+	}
+	// Only if there are none left today
+	if events.TomorrowEvents != nil {
+		t.Errorf("unexpected events tomorrow %v", *events.TomorrowEvents)
+	}
+	if s := spans(events.TodayAllDayEvents); s != "Urlaub 2/3, Müllabfuhr 0/0" {
+		t.Errorf("unexpected all-day events today %s", s)
+	}
+	if s := spans(events.TomorrowAllDayEvents); s != "Urlaub 3/3, Geburtstag 0/0" {
+		t.Errorf("unexpected all-day events tomorrow %s", s)
+	}
+
+	// Tomorrow's events after today's are over
+	events, err = getNextEvents([]Provider{provider}, nil, at(7, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events.TodayEvents != nil || events.TomorrowEvents == nil || (*events.TomorrowEvents)[0].Summary != "Chor" {
+		t.Errorf("unexpected events today %v and tomorrow %v", events.TodayEvents, events.TomorrowEvents)
+	}
+}
+
+func TestGetNextEventsOnDaylightSavingTime(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	// The day of the change has 23 hours
+	now := time.Date(2017, 3, 26, 10, 0, 0, 0, berlin)
+	monday := time.Date(2017, 3, 27, 0, 0, 0, 0, berlin)
+	provider := fixedCalendar{
+		{Summary: "Urlaub", Start: monday, End: monday.AddDate(0, 0, 1), AllDay: true},
+		{Summary: "Frühschicht", Start: monday.Add(30 * time.Minute), End: monday.Add(8 * time.Hour)},
+	}
+	events, err := getNextEvents([]Provider{provider}, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events.TodayAllDayEvents != nil || events.TodayEvents != nil {
+		t.Errorf("Monday's events today: %v, %v", events.TodayAllDayEvents, events.TodayEvents)
+	}
+	if s := spans(events.TomorrowAllDayEvents); s != "Urlaub 0/0" || events.TomorrowEvents == nil {
+		t.Errorf("unexpected events tomorrow %s, %v", s, events.TomorrowEvents)
+	}
+}
+
+func TestGetEventsOngoing(t *testing.T) {
+	at := func(day int, hour int) time.Time {
+		return time.Date(2017, 3, day, hour, 0, 0, 0, time.Local)
+	}
+	provider := fixedCalendar{
+		{Summary: "Konferenz", Start: at(6, 9), End: at(8, 17)},
+		{Summary: "Nachtschicht", Start: at(7, 22), End: at(8, 6)},
+	}
+	days, err := GetEvents([]Provider{provider}, nil, Window{at(8, 3), at(9, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || !days[0].Date.Equal(at(8, 0)) || len(days[0].Ongoing) != 2 {
+		t.Fatalf("unexpected days %+v", days)
+	}
+	for i, expected := range [][2]int{{3, 3}, {2, 2}} {
+		e := days[0].Ongoing[i]
+		if e.Day != expected[0] || e.Days != expected[1] {
+			t.Errorf("%s: expected day %d of %d, got %d of %d", e.Summary, expected[0], expected[1], e.Day, e.Days)
+		}
+	}
+}
+
+// spans lists the summaries of events with their day and number of days
+func spans(events *[]Event) string {
+	if events == nil {
+		return ""
+	}
+	ret := ""
+	for i, e := range *events {
+		if i > 0 {
+			ret += ", "
+		}
+		ret += fmt.Sprintf("%s %d/%d", e.Summary, e.Day, e.Days)
+	}
+	return ret
+}
@@ -0,0 +1,17 @@
+package calendar
+
+import "errors"
+
+// Kinds of errors when fetching events. They are returned as
+// Kind of a *failure.Error
+var (
+	// None of the configured calendars exists
+	ErrNoData = errors.New("no calendar found")
+	// The calendar service refuses the access
+	ErrAuth = errors.New("calendar authorization failed")
+	// The access has not been authorized yet or the authorization has
+	// expired or has been revoked
+	ErrReauthorize = errors.New("calendar access needs to be authorized")
+	// The calendar service cannot be reached or fails
+	ErrBackendUnavailable = errors.New("calendar service unavailable")
+)
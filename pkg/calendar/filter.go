@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"regexp"
+	"time"
+)
+
+// How private events are announced
+const (
+	// Announce them like any other event
+	PrivateShow = "show"
+	// Announce them without summary and details
+	PrivateMask = "mask"
+	// Leave them out
+	PrivateHide = "hide"
+)
+
+// Filter decides which events of a calendar are announced and how
+type Filter struct {
+	// Name to announce instead of the name of the calendar, if set
+	Alias string
+	// Only events with a summary matching one of Include (if any given) and
+	// none of Exclude are announced
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+	// Whether to announce events declined by the user and timed events
+	// marked as free. All-day events are mostly free, so they are always kept
+	ShowDeclined bool
+	ShowFree     bool
+	// One of PrivateShow, PrivateMask and PrivateHide
+	Private string
+}
+
+// filtered is a provider whose events are filtered
+type filtered struct {
+	provider Provider
+	filter   Filter
+}
+
+// Filtered applies the filter to the events of the provider
+func Filtered(provider Provider, filter Filter) Provider {
+	return &filtered{provider, filter}
+}
+
+func (f *filtered) Name() string {
+	if f.filter.Alias != "" {
+		return f.filter.Alias
+	}
+	return f.provider.Name()
+}
+
+func (f *filtered) Items(start time.Time, end time.Time) ([]Item, error) {
+	items, err := f.provider.Items(start, end)
+	if err != nil {
+		return nil, err
+	}
+	ret := []Item{}
+	for _, item := range items {
+		if item, keep := f.filter.apply(item); keep {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
+
+// apply returns the item as to announce and whether to announce it at all
+func (f Filter) apply(item Item) (Item, bool) {
+	switch {
+	case item.Declined && !f.ShowDeclined:
+		return item, false
+	case item.Free && !item.AllDay && !f.ShowFree:
+		return item, false
+	case !f.matches(item.Summary):
+		return item, false
+	}
+	if item.Private {
+		switch f.Private {
+		case PrivateHide:
+			return item, false
+		case PrivateShow:
+		default:
+			item = Item{
+				Start:   item.Start,
+				End:     item.End,
+				AllDay:  item.AllDay,
+				Private: true,
+				Masked:  true,
+				// Reminders are kept as they don't tell anything
+				Reminders: item.Reminders,
+			}
+		}
+	}
+	return item, true
+}
+
+func (f Filter) matches(summary string) bool {
+	for _, re := range f.Exclude {
+		if re.MatchString(summary) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, re := range f.Include {
+		if re.MatchString(summary) {
+			return true
+		}
+	}
+	return false
+}
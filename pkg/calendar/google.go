@@ -0,0 +1,256 @@
+package calendar
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	gcalendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// googleCalendar is a calendar of a Google account
+type googleCalendar struct {
+	srv  *gcalendar.Service
+	id   string
+	name string
+}
+
+// NewGoogleProviders looks up calendars in the Google account the tokens are
+// issued for and returns them by the given names. Calendars are given by
+// their ID, which survives renaming, or by their name, ignoring case. The
+// name can also be the one the user has given a calendar shared with them.
+// Calendars not found are warned about. It fails with ErrNoData if none of
+// them exists
+func NewGoogleProviders(tokens oauth2.TokenSource, names []string) (map[string]Provider, error) {
+	if len(names) == 0 {
+		return map[string]Provider{}, nil
+	}
+	srv, err := gcalendar.New(oauth2.NewClient(context.Background(), tokens))
+	if err != nil {
+		return nil, classify(err)
+	}
+	return googleProviders(srv, names)
+}
+
+func googleProviders(srv *gcalendar.Service, names []string) (map[string]Provider, error) {
+	var entries []*gcalendar.CalendarListEntry
+	err := srv.CalendarList.List().Pages(context.Background(), func(page *gcalendar.CalendarList) error {
+		entries = append(entries, page.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	ret := map[string]Provider{}
+	known := []string{}
+	for _, i := range entries {
+		known = append(known, i.Summary)
+		for _, j := range names {
+			if _, found := ret[j]; !found && matchesCalendar(i, j) {
+				ret[j] = &googleCalendar{
+					srv:  srv,
+					id:   i.Id,
+					name: i.Summary,
+				}
+			}
+		}
+	}
+	// Calendars shared with a service account are not part of its calendar
+	// list, so they are given by their ID like "family123@group.calendar.google.com"
+	for _, j := range names {
+		if _, found := ret[j]; found || (!strings.Contains(j, "@") && j != "primary") {
+			continue
+		}
+		c, err := srv.Calendars.Get(j).Do()
+		if err != nil {
+			logger.Warnf("Cannot access calendar %s: %v", j, err)
+			continue
+		}
+		ret[j] = &googleCalendar{
+			srv:  srv,
+			id:   c.Id,
+			name: c.Summary,
+		}
+	}
+	for _, j := range names {
+		if _, found := ret[j]; !found {
+			logger.Warnf("No Google calendar %s found, known are: %s", j, strings.Join(known, ", "))
+		}
+	}
+	if len(ret) == 0 {
+		return nil, failure.New(ErrNoData, fmt.Errorf("none of the calendars %v exists", names))
+	}
+	logger.Debugf("Calendars: %v", names)
+	return ret, nil
+}
+
+// matchesCalendar checks whether a calendar is the one given by ID or name
+func matchesCalendar(entry *gcalendar.CalendarListEntry, name string) bool {
+	name = strings.TrimSpace(name)
+	return entry.Id == name || strings.EqualFold(entry.Summary, name) ||
+		(entry.SummaryOverride != "" && strings.EqualFold(entry.SummaryOverride, name))
+}
+
+func (c *googleCalendar) Name() string {
+	return c.name
+}
+
+func (c *googleCalendar) Items(start time.Time, end time.Time) ([]Item, error) {
+	var events []*gcalendar.Event
+	var defaults []*gcalendar.EventReminder
+	err := c.srv.Events.List(c.id).ShowDeleted(false).
+		SingleEvents(true).TimeMin(start.Format(time.RFC3339)).TimeMax(end.Format(time.RFC3339)).OrderBy("startTime").
+		Pages(context.Background(), func(page *gcalendar.Events) error {
+			events = append(events, page.Items...)
+			defaults = page.DefaultReminders
+			return nil
+		})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	ret := []Item{}
+	for _, i := range events {
+		item, err := googleItem(i, defaults)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+func (c *googleCalendar) cacheKey() string {
+	return "google/" + c.id
+}
+
+// sync fetches the events changed since the last sync with the sync token
+// of the last sync. The first sync fetches the events of the next two
+// months, as recurring events are expanded into their occurrences. Once
+// half of this window has passed, the copy is synced from scratch again
+func (c *googleCalendar) sync(state *syncState, now time.Time) error {
+	if state.Token != "" && state.End.Before(now.AddDate(0, 0, cacheDays/2)) {
+		fresh := syncState{}
+		if err := c.sync(&fresh, now); err != nil {
+			return err
+		}
+		*state = fresh
+		return nil
+	}
+	call := c.srv.Events.List(c.id).SingleEvents(true)
+	start := midnight(now)
+	end := start.AddDate(0, 0, cacheDays)
+	if state.Token != "" {
+		call = call.SyncToken(state.Token)
+	} else {
+		call = call.TimeMin(start.Format(time.RFC3339)).TimeMax(end.Format(time.RFC3339))
+	}
+	var changed []*gcalendar.Event
+	var defaults []*gcalendar.EventReminder
+	token := ""
+	err := call.Pages(context.Background(), func(page *gcalendar.Events) error {
+		changed = append(changed, page.Items...)
+		defaults = page.DefaultReminders
+		token = page.NextSyncToken
+		return nil
+	})
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusGone && state.Token != "" {
+		// The sync token has expired, so start over
+		logger.Infof("Sync token of calendar %s has expired", c.name)
+		fresh := syncState{}
+		if err := c.sync(&fresh, now); err != nil {
+			return err
+		}
+		*state = fresh
+		return nil
+	}
+	if err != nil {
+		return classify(err)
+	}
+
+	entries := map[string]*entry{}
+	if state.Token != "" {
+		for id, e := range state.Entries {
+			entries[id] = e
+		}
+		end = state.End
+	}
+	for _, i := range changed {
+		delete(entries, i.Id)
+		if i.Status == "cancelled" {
+			continue
+		}
+		item, err := googleItem(i, defaults)
+		if err != nil {
+			return err
+		}
+		// Changes aren't limited to the window of the first sync
+		if overlaps(item, start, end) {
+			entries[i.Id] = &entry{Items: []Item{item}}
+		}
+	}
+	if state.Token == "" {
+		state.Start, state.End = start, end
+	}
+	state.Entries, state.Token = entries, token
+	return nil
+}
+
+// googleItem converts a Google event. defaults are the reminders of the
+// calendar used by events without reminders of their own
+func googleItem(i *gcalendar.Event, defaults []*gcalendar.EventReminder) (Item, error) {
+	item := Item{
+		Summary: i.Summary,
+		Private: i.Visibility == "private" || i.Visibility == "confidential",
+		Free:    i.Transparency == "transparent",
+
+		Location:    i.Location,
+		Description: i.Description,
+	}
+	for _, a := range i.Attendees {
+		switch {
+		case a.Self:
+			item.Declined = a.ResponseStatus == "declined"
+		case a.Resource:
+		case a.DisplayName != "":
+			item.Attendees = append(item.Attendees, a.DisplayName)
+		default:
+			item.Attendees = append(item.Attendees, a.Email)
+		}
+	}
+	if i.Reminders != nil {
+		reminders := i.Reminders.Overrides
+		if i.Reminders.UseDefault {
+			reminders = defaults
+		}
+		for _, r := range reminders {
+			item.Reminders = append(item.Reminders, time.Duration(r.Minutes)*time.Minute)
+		}
+	}
+	// If the DateTime is an empty string the Event is an all-day Event.
+	// So only Date is available.
+	var err error
+	if i.Start.DateTime == "" {
+		item.AllDay = true
+		if item.Start, err = time.ParseInLocation("2006-01-02", i.Start.Date, time.Local); err != nil {
+			return item, err
+		}
+		if item.End, err = time.ParseInLocation("2006-01-02", i.End.Date, time.Local); err != nil {
+			return item, err
+		}
+	} else {
+		if item.Start, err = time.Parse(time.RFC3339, i.Start.DateTime); err != nil {
+			return item, err
+		}
+		if item.End, err = time.Parse(time.RFC3339, i.End.DateTime); err != nil {
+			return item, err
+		}
+	}
+	return item, nil
+}
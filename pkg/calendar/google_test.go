@@ -0,0 +1,173 @@
+package calendar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	gcalendar "google.golang.org/api/calendar/v3"
+)
+
+// googleServer answers the event lists of a Google calendar with the
+// events given for the next request
+type googleServer struct {
+	events []*gcalendar.Event
+	// Query of the last request
+	query url.Values
+}
+
+func (s *googleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/calendars/family/events" {
+		http.NotFound(w, r)
+		return
+	}
+	s.query = r.URL.Query()
+	json.NewEncoder(w).Encode(&gcalendar.Events{Items: s.events, NextSyncToken: "token"})
+	s.events = nil
+}
+
+func googleEvent(id string, summary string, start time.Time) *gcalendar.Event {
+	return &gcalendar.Event{
+		Id:      id,
+		Summary: summary,
+		Start:   &gcalendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &gcalendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+	}
+}
+
+func TestGoogleSync(t *testing.T) {
+	s := &googleServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	srv, err := gcalendar.New(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.BasePath = server.URL + "/"
+	c := &googleCalendar{srv: srv, id: "family", name: "Familie"}
+
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	state := &syncState{}
+	s.events = []*gcalendar.Event{googleEvent("dentist", "Zahnarzt", now.AddDate(0, 0, 7))}
+	if err := c.sync(state, now); err != nil {
+		t.Fatal(err)
+	}
+	// The first sync is limited, as recurring events are expanded
+	end := midnight(now).AddDate(0, 0, cacheDays)
+	if s.query.Get("timeMax") != end.Format(time.RFC3339) || s.query.Get("singleEvents") != "true" {
+		t.Errorf("first sync not limited: %v", s.query)
+	}
+	if !state.Start.Equal(midnight(now)) || !state.End.Equal(end) || len(state.Entries) != 1 {
+		t.Errorf("unexpected copy %v - %v with %d events", state.Start, state.End, len(state.Entries))
+	}
+
+	// Changes beyond the window are left out
+	s.events = []*gcalendar.Event{
+		googleEvent("dentist", "Zahnarzt", now.AddDate(0, 0, 100)),
+		googleEvent("school", "Elternabend", now.AddDate(0, 0, 3)),
+	}
+	if err := c.sync(state, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if s.query.Get("syncToken") != "token" || s.query.Get("timeMax") != "" {
+		t.Errorf("not synced incrementally: %v", s.query)
+	}
+	if len(state.Entries) != 1 || state.Entries["school"] == nil || !state.End.Equal(end) {
+		t.Errorf("unexpected events %v until %v", state.Entries, state.End)
+	}
+
+	// Synced from scratch once half of the window has passed
+	later := now.AddDate(0, 0, cacheDays/2+1)
+	if err := c.sync(state, later); err != nil {
+		t.Fatal(err)
+	}
+	if s.query.Get("syncToken") != "" || !state.End.Equal(midnight(later).AddDate(0, 0, cacheDays)) {
+		t.Errorf("window not moved: %v, %v", s.query, state.End)
+	}
+}
+
+// googleAccount answers the calendar list of an account in pages of two
+// calendars and the calendars shared with it
+type googleAccount struct {
+	calendars []*gcalendar.CalendarListEntry
+	shared    map[string]*gcalendar.Calendar
+	// Page tokens of the calendar list requests
+	pages []string
+}
+
+func (a *googleAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/users/me/calendarList" {
+		token := r.URL.Query().Get("pageToken")
+		a.pages = append(a.pages, token)
+		start, _ := strconv.Atoi(token)
+		list := &gcalendar.CalendarList{Items: a.calendars[start:]}
+		if len(list.Items) > 2 {
+			list.Items = list.Items[:2]
+			list.NextPageToken = strconv.Itoa(start + 2)
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+	if c, found := a.shared[strings.TrimPrefix(r.URL.Path, "/calendars/")]; found {
+		json.NewEncoder(w).Encode(c)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func TestGoogleProviders(t *testing.T) {
+	account := &googleAccount{
+		calendars: []*gcalendar.CalendarListEntry{
+			{Id: "roland@gmail.com", Summary: "roland@gmail.com"},
+			{Id: "family123@group.calendar.google.com", Summary: "Familie"},
+			{Id: "de.german#holiday@group.v.calendar.google.com", Summary: "Feiertage in Deutschland"},
+			{Id: "school456@group.calendar.google.com", Summary: "Klasse 4b", SummaryOverride: "Schule"},
+		},
+		shared: map[string]*gcalendar.Calendar{
+			"club789@group.calendar.google.com": {Id: "club789@group.calendar.google.com", Summary: "Verein"},
+		},
+	}
+	server := httptest.NewServer(account)
+	defer server.Close()
+	srv, err := gcalendar.New(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.BasePath = server.URL + "/"
+
+	providers, err := googleProviders(srv, []string{
+		"FAMILIE", " Feiertage in Deutschland", "school456@group.calendar.google.com", "schule",
+		"club789@group.calendar.google.com", "Klasse 4a", "unknown@group.calendar.google.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(account.pages, []string{"", "2"}) {
+		t.Errorf("expected two pages of calendars, got %v", account.pages)
+	}
+	for name, expected := range map[string]string{
+		"FAMILIE":                             "family123@group.calendar.google.com",
+		" Feiertage in Deutschland":           "de.german#holiday@group.v.calendar.google.com",
+		"school456@group.calendar.google.com": "school456@group.calendar.google.com",
+		"schule":                              "school456@group.calendar.google.com",
+		"club789@group.calendar.google.com":   "club789@group.calendar.google.com",
+	} {
+		if p, found := providers[name]; !found || p.(*googleCalendar).id != expected {
+			t.Errorf("%s: expected calendar %s, got %v", name, expected, p)
+		}
+	}
+	if len(providers) != 5 {
+		t.Errorf("unexpected calendars %v", providers)
+	}
+
+	if _, err := googleProviders(srv, []string{"Klasse 4a"}); failure.Kind(err) != ErrNoData {
+		t.Errorf("expected no data, got %v", err)
+	}
+}
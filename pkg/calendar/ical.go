@@ -0,0 +1,395 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vevent is an event of an iCalendar (RFC 5545) file
+type vevent struct {
+	uid     string
+	summary string
+	start   time.Time
+	end     time.Time
+	allDay  bool
+	rrule   string
+	exdates []time.Time
+	private bool
+	free    bool
+
+	location    string
+	description string
+	attendees   []string
+	reminders   []time.Duration
+	// Start of the replaced occurrence if this event overrides a single
+	// occurrence of a recurring event
+	recurrenceID time.Time
+	// Only set for overrides, which cancel their occurrence
+	cancelled bool
+}
+
+// icsProperty is a content line like "DTSTART;TZID=Europe/Berlin:20170101T100000"
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICS reads all events of an iCalendar file. Cancelled events are
+// skipped, except for overrides cancelling a single occurrence
+func parseICS(r io.Reader) ([]*vevent, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*vevent{}
+	var event *vevent
+	var duration string
+	cancelled := false
+	// Depth of components nested into an event and whether the outermost
+	// of them is an alarm
+	nested := 0
+	alarm := false
+	for _, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case prop.name == "BEGIN" && prop.value == "VEVENT":
+			event, duration, cancelled, nested = &vevent{}, "", false, 0
+			continue
+		case event == nil:
+			continue
+		case prop.name == "BEGIN":
+			if nested == 0 {
+				alarm = prop.value == "VALARM"
+			}
+			nested++
+			continue
+		case prop.name == "END" && nested > 0:
+			nested--
+			continue
+		case nested == 1 && alarm && prop.name == "TRIGGER":
+			if reminder, ok := parseTrigger(prop); ok {
+				event.reminders = append(event.reminders, reminder)
+			}
+			continue
+		case nested > 0:
+			continue
+		case prop.name == "END" && prop.value == "VEVENT":
+			if err := finishEvent(event, duration); err != nil {
+				return nil, err
+			}
+			if !event.recurrenceID.IsZero() {
+				event.cancelled = cancelled
+				events = append(events, event)
+			} else if !cancelled {
+				events = append(events, event)
+			}
+			event = nil
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			event.uid = prop.value
+		case "SUMMARY":
+			event.summary = unescapeText(prop.value)
+		case "LOCATION":
+			event.location = unescapeText(prop.value)
+		case "DESCRIPTION":
+			event.description = unescapeText(prop.value)
+		case "ATTENDEE":
+			if name := prop.params["CN"]; name != "" {
+				event.attendees = append(event.attendees, name)
+			} else {
+				event.attendees = append(event.attendees, strings.TrimPrefix(strings.ToLower(prop.value), "mailto:"))
+			}
+		case "DTSTART":
+			event.start, event.allDay, err = parseICSTime(prop)
+		case "DTEND":
+			event.end, _, err = parseICSTime(prop)
+		case "DURATION":
+			duration = prop.value
+		case "RRULE":
+			event.rrule = prop.value
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				var exdate time.Time
+				exdate, _, err = parseICSTime(icsProperty{prop.name, prop.params, value})
+				if err != nil {
+					break
+				}
+				event.exdates = append(event.exdates, exdate)
+			}
+		case "RECURRENCE-ID":
+			event.recurrenceID, _, err = parseICSTime(prop)
+		case "STATUS":
+			cancelled = prop.value == "CANCELLED"
+		case "CLASS":
+			event.private = prop.value == "PRIVATE" || prop.value == "CONFIDENTIAL"
+		case "TRANSP":
+			event.free = prop.value == "TRANSPARENT"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %v", prop.name, prop.value, err)
+		}
+	}
+	return events, nil
+}
+
+// finishEvent checks an event and calculates its end if not given
+func finishEvent(event *vevent, duration string) error {
+	if event.start.IsZero() {
+		return fmt.Errorf("event '%s' has no start", event.summary)
+	}
+	if event.end.IsZero() {
+		switch {
+		case duration != "":
+			d, err := parseDuration(duration)
+			if err != nil {
+				return err
+			}
+			event.end = event.start.Add(d)
+		case event.allDay:
+			event.end = event.start.AddDate(0, 0, 1)
+		default:
+			event.end = event.start
+		}
+	}
+	return nil
+}
+
+// unfoldLines splits the content into lines, joining folded lines
+func unfoldLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (icsProperty, error) {
+	prop := icsProperty{params: map[string]string{}}
+	// The value starts at the first colon outside of quoted parameter values
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("invalid iCalendar line '%s'", line)
+	}
+	prop.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if kv := strings.SplitN(param, "=", 2); len(kv) == 2 {
+			prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return prop, nil
+}
+
+// parseICSTime parses a date or date-time value. Dates are taken as local
+// midnight. It returns whether the value is a date
+func parseICSTime(prop icsProperty) (time.Time, bool, error) {
+	value := prop.value
+	if prop.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := time.Local
+	if tzid := prop.params["TZID"]; tzid != "" {
+		// Unknown zones, e.g. Windows names used by Outlook, are taken as local time
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseTrigger returns how long before the start of an event an alarm is due.
+// Only alarms relative to the start are considered
+func parseTrigger(prop icsProperty) (time.Duration, bool) {
+	if prop.params["VALUE"] == "DATE-TIME" || prop.params["RELATED"] == "END" {
+		return 0, false
+	}
+	d, err := parseDuration(prop.value)
+	if err != nil {
+		return 0, false
+	}
+	return -d, true
+}
+
+// parseDuration parses a duration like "PT1H30M" or "P1D"
+func parseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, c := range s[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			number += string(c)
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", value)
+		}
+		number = ""
+		switch {
+		case c == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration '%s'", value)
+		}
+	}
+	return sign * d, nil
+}
+
+func unescapeText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// expandEvents returns the events and occurrences of recurring events
+// overlapping the window from start to end
+func expandEvents(events []*vevent, start time.Time, end time.Time) []Item {
+	// Occurrences replaced by other events
+	overridden := map[string]bool{}
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			overridden[e.uid+"/"+e.recurrenceID.UTC().Format(time.RFC3339)] = true
+		}
+	}
+
+	items := []Item{}
+	for _, e := range events {
+		if e.cancelled {
+			continue
+		}
+		length := e.end.Sub(e.start)
+		if e.rrule == "" || !e.recurrenceID.IsZero() {
+			item := e.item(e.start, e.end)
+			if overlaps(item, start, end) {
+				items = append(items, item)
+			}
+			continue
+		}
+
+		rule, err := parseRRule(e.rrule, e.start.Location())
+		if err != nil {
+			// Better miss a single event than all of the calendar
+			skipRule(e, err)
+			continue
+		}
+		// Occurrences starting before the window may still last into it
+		for _, occurrence := range rule.occurrences(e.start, start.Add(-length), end) {
+			if overridden[e.uid+"/"+occurrence.UTC().Format(time.RFC3339)] || excluded(e, occurrence) {
+				continue
+			}
+			item := e.item(occurrence, occurrence.Add(length))
+			if e.allDay {
+				// Keep all-day events at midnight across DST changes
+				item.End = occurrence.AddDate(0, 0, int(length.Hours()/24+0.5))
+			}
+			if overlaps(item, start, end) {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// Recurring events skipped already, as the same events are expanded again
+// and again
+var skippedRules = struct {
+	sync.Mutex
+	events map[string]bool
+}{events: map[string]bool{}}
+
+// skipRule warns once about a recurring event which can't be expanded
+func skipRule(e *vevent, err error) {
+	skippedRules.Lock()
+	defer skippedRules.Unlock()
+	key := e.uid + "/" + e.rrule
+	if !skippedRules.events[key] {
+		skippedRules.events[key] = true
+		logger.Warnf("Skipping recurring event '%s': %v", e.summary, err)
+	}
+}
+
+func (e *vevent) item(start time.Time, end time.Time) Item {
+	return Item{
+		Summary: e.summary,
+		Start:   start,
+		End:     end,
+		AllDay:  e.allDay,
+		Private: e.private,
+		Free:    e.free,
+
+		Location:    e.location,
+		Description: e.description,
+		Attendees:   e.attendees,
+		Reminders:   e.reminders,
+	}
+}
+
+func excluded(e *vevent, occurrence time.Time) bool {
+	for _, exdate := range e.exdates {
+		if exdate.Equal(occurrence) {
+			return true
+		}
+		// Dates exclude the whole day
+		if e.allDay && exdate.Year() == occurrence.Year() && exdate.YearDay() == occurrence.YearDay() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return loc
+}
+
+func parseTestFile(t *testing.T, name string) []*vevent {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, err := parseICS(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func findEvent(events []*vevent, summary string) *vevent {
+	for _, e := range events {
+		if e.summary == summary {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestParseICS(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	events := parseTestFile(t, "family.ics")
+
+	summaries := []string{}
+	for _, e := range events {
+		summaries = append(summaries, e.summary)
+	}
+	// The cancelled event is skipped, but not the cancelled override
+	expected := []string{"Chor", "Chor (später)", "Chor", "Stammtisch", "Müllabfuhr", "Urlaub", "Zahnarzt", "Sportfest"}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Fatalf("expected events %v, got %v", expected, summaries)
+	}
+
+	choir := events[0]
+	if !choir.start.Equal(time.Date(2017, 3, 2, 19, 30, 0, 0, berlin)) || choir.start.Location().String() != "Europe/Berlin" {
+		t.Errorf("start of %s not in its time zone: %v", choir.summary, choir.start)
+	}
+	if len(choir.exdates) != 1 || !choir.exdates[0].Equal(time.Date(2017, 3, 16, 19, 30, 0, 0, berlin)) {
+		t.Errorf("unexpected exdates %v", choir.exdates)
+	}
+	if moved := events[1]; !moved.recurrenceID.Equal(time.Date(2017, 3, 23, 19, 30, 0, 0, berlin)) || moved.cancelled {
+		t.Errorf("unexpected override %+v", moved)
+	}
+	if cancelled := events[2]; cancelled.recurrenceID.IsZero() || !cancelled.cancelled {
+		t.Errorf("override not cancelled: %+v", cancelled)
+	}
+
+	dentist := findEvent(events, "Zahnarzt")
+	if !dentist.end.Equal(dentist.start.Add(time.Hour)) {
+		t.Errorf("end not calculated from duration: %v - %v", dentist.start, dentist.end)
+	}
+	if dentist.location != "Hauptstraße 1, Berlin" {
+		t.Errorf("unexpected location %q", dentist.location)
+	}
+	if dentist.description != "Kontrolle Bitte Bonusheft mitbringen und rechtzeitig vorher Bescheid geben" {
+		t.Errorf("unexpected description %q", dentist.description)
+	}
+	if !reflect.DeepEqual(dentist.attendees, []string{"Roland", "dr.zahn@example.com"}) {
+		t.Errorf("unexpected attendees %v", dentist.attendees)
+	}
+	// Alarms at a fixed time are ignored
+	if !reflect.DeepEqual(dentist.reminders, []time.Duration{30 * time.Minute}) {
+		t.Errorf("unexpected reminders %v", dentist.reminders)
+	}
+
+	vacation := findEvent(events, "Urlaub")
+	if !vacation.allDay || !vacation.private || vacation.free {
+		t.Errorf("unexpected flags of %+v", vacation)
+	}
+	if !vacation.start.Equal(time.Date(2017, 3, 13, 0, 0, 0, 0, time.Local)) || !vacation.end.Equal(time.Date(2017, 3, 18, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected days %v - %v", vacation.start, vacation.end)
+	}
+	if waste := findEvent(events, "Müllabfuhr"); !waste.free {
+		t.Error("transparent event not free")
+	}
+}
+
+func TestParseICSInvalid(t *testing.T) {
+	for _, data := range []string{
+		"BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:2017-03-01\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20170301T100000Z\nDURATION:1H\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nno property\nEND:VEVENT\n",
+	} {
+		if _, err := parseICS(strings.NewReader(data)); err == nil {
+			t.Errorf("no error for %q", data)
+		}
+	}
+}
+
+func TestExpandEvents(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	events := parseTestFile(t, "family.ics")
+
+	start := time.Date(2017, 3, 1, 0, 0, 0, 0, berlin)
+	end := time.Date(2017, 4, 10, 0, 0, 0, 0, berlin)
+	items := expandEvents(events, start, end)
+	sort.Slice(items, func(i, j int) bool { return items[i].Start.Before(items[j].Start) })
+
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2017, month, day, 0, 0, 0, 0, time.Local)
+	}
+	expected := []struct {
+		summary string
+		start   time.Time
+		end     time.Time
+	}{
+		{"Chor", time.Date(2017, 3, 2, 19, 30, 0, 0, berlin), time.Date(2017, 3, 2, 21, 0, 0, 0, berlin)},
+		{"Müllabfuhr", day(3, 6), day(3, 7)},
+		{"Zahnarzt", time.Date(2017, 3, 8, 8, 0, 0, 0, time.UTC), time.Date(2017, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"Chor", time.Date(2017, 3, 9, 19, 30, 0, 0, berlin), time.Date(2017, 3, 9, 21, 0, 0, 0, berlin)},
+		{"Urlaub", day(3, 13), day(3, 18)},
+		// 16th excluded
+		{"Müllabfuhr", day(3, 20), day(3, 21)},
+		{"Chor (später)", time.Date(2017, 3, 23, 20, 0, 0, 0, berlin), time.Date(2017, 3, 23, 21, 30, 0, 0, berlin)},
+		// 30th cancelled. The last workday of March
+		{"Stammtisch", time.Date(2017, 3, 31, 17, 0, 0, 0, time.UTC), time.Date(2017, 3, 31, 20, 0, 0, 0, time.UTC)},
+		{"Müllabfuhr", day(4, 3), day(4, 4)},
+		// After the change to daylight saving time at the same local time
+		{"Chor", time.Date(2017, 4, 6, 19, 30, 0, 0, berlin), time.Date(2017, 4, 6, 21, 0, 0, 0, berlin)},
+	}
+	if len(items) != len(expected) {
+		for _, item := range items {
+			t.Logf("%s %v", item.Summary, item.Start)
+		}
+		t.Fatalf("expected %d items, got %d", len(expected), len(items))
+	}
+	for i, e := range expected {
+		item := items[i]
+		if item.Summary != e.summary || !item.Start.Equal(e.start) || !item.End.Equal(e.end) {
+			t.Errorf("item %d: expected %s %v - %v, got %s %v - %v", i, e.summary, e.start, e.end, item.Summary, item.Start, item.End)
+		}
+	}
+}
+
+func TestExpandEventsOverlapping(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	events := parseTestFile(t, "family.ics")
+
+	// The choir on the 9th started before and lasts into the window
+	start := time.Date(2017, 3, 9, 20, 0, 0, 0, berlin)
+	items := expandEvents(events, start, start.Add(time.Hour))
+	if len(items) != 1 || items[0].Summary != "Chor" {
+		t.Errorf("expected the running choir only, got %v", items)
+	}
+}
@@ -0,0 +1,159 @@
+package calendar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/failure"
+)
+
+// icsCalendar is an iCalendar feed given by a URL or a file
+type icsCalendar struct {
+	name   string
+	source string
+	client *http.Client
+}
+
+// NewICSProvider creates a provider for an iCalendar feed. The source is
+// an http(s) or webcal URL or the path of a local file
+func NewICSProvider(name string, source string) Provider {
+	return &icsCalendar{
+		name:   name,
+		source: source,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *icsCalendar) Name() string {
+	return c.name
+}
+
+func (c *icsCalendar) Items(start time.Time, end time.Time) ([]Item, error) {
+	body, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	events, err := parseICS(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse calendar %s: %v", c.name, err)
+	}
+	return expandEvents(events, start, end), nil
+}
+
+func (c *icsCalendar) open() (io.ReadCloser, error) {
+	if source, remote := c.url(); remote {
+		resp, err := c.get(source, nil)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	return os.Open(c.source)
+}
+
+// url returns the URL to fetch the feed from and whether it is a remote one
+func (c *icsCalendar) url() (string, bool) {
+	source := c.source
+	if strings.HasPrefix(source, "webcal://") {
+		source = "https://" + strings.TrimPrefix(source, "webcal://")
+	}
+	return source, strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// get fetches the feed with the given request headers. Answers other than
+// successful ones or "not modified" are returned as error
+func (c *icsCalendar) get(source string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, failure.New(ErrBackendUnavailable, err)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	if err := checkStatus(resp, c.name); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *icsCalendar) cacheKey() string {
+	return "ics/" + c.source
+}
+
+// sync fetches the feed if it has changed since the last sync, as told by
+// its ETag or modification time
+func (c *icsCalendar) sync(state *syncState, now time.Time) error {
+	var data []byte
+	var token, modified string
+	source, remote := c.url()
+	if remote {
+		header := http.Header{}
+		if state.Token != "" {
+			header.Set("If-None-Match", state.Token)
+		}
+		if state.Modified != "" {
+			header.Set("If-Modified-Since", state.Modified)
+		}
+		resp, err := c.get(source, header)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotModified {
+			return nil
+		}
+		if data, err = ioutil.ReadAll(resp.Body); err != nil {
+			return failure.New(ErrBackendUnavailable, err)
+		}
+		token, modified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	} else {
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		token = info.ModTime().Format(time.RFC3339Nano)
+		if token == state.Token {
+			return nil
+		}
+		if data, err = ioutil.ReadFile(source); err != nil {
+			return err
+		}
+	}
+
+	events, err := parseICS(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot parse calendar %s: %v", c.name, err)
+	}
+	state.Entries = map[string]*entry{"": {Data: string(data), events: events}}
+	state.Token, state.Modified = token, modified
+	state.Start, state.End = time.Time{}, time.Time{}
+	return nil
+}
+
+// checkStatus turns an unsuccessful HTTP response into an *Error
+func checkStatus(resp *http.Response, name string) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return failure.New(ErrAuth, fmt.Errorf("calendar %s: %s", name, resp.Status))
+	case resp.StatusCode == http.StatusNotFound:
+		return failure.New(ErrNoData, fmt.Errorf("calendar %s: %s", name, resp.Status))
+	case resp.StatusCode >= 300:
+		return failure.New(ErrBackendUnavailable, fmt.Errorf("calendar %s: %s", name, resp.Status))
+	}
+	return nil
+}
@@ -3,8 +3,11 @@ package calendar
 import "time"
 
 type NextEvents struct {
+	// Events which started before now and are still running
+	OngoingEvents        *[]TimedEvent
 	TodayEvents          *[]TimedEvent
 	TomorrowEvents       *[]TimedEvent
+	TodayAllDayEvents    *[]Event
 	TomorrowAllDayEvents *[]Event
 }
 
@@ -19,4 +22,32 @@ type TimedEvent struct {
 type Event struct {
 	Calendar string
 	Summary  string
+	// Private event without summary and details, to be announced with a
+	// general summary in the language of the answer
+	Masked bool
+	// For events lasting several days the number of the day at hand,
+	// starting with 1, and the number of days. Both are 0 otherwise
+	Day  int
+	Days int
+
+	Location    string
+	Description string
+	Attendees   []string
+	// How long before the start reminders are due
+	Reminders []time.Duration
+}
+
+// Day holds the events of a single day
+type Day struct {
+	// Midnight at the start of the day
+	Date    time.Time
+	AllDay  []Event
+	Ongoing []TimedEvent
+	Timed   []TimedEvent
 }
+
+type byDate []Day
+
+func (a byDate) Len() int           { return len(a) }
+func (a byDate) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byDate) Less(i, j int) bool { return a[i].Date.Before(a[j].Date) }
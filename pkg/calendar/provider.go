@@ -0,0 +1,50 @@
+package calendar
+
+import "time"
+
+// Item is an event as delivered by a provider. All-day events start and end
+// at midnight, with the end being exclusive
+type Item struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+	// Visible to the owner only
+	Private bool
+	// Private event whose summary and details are left out, so that it is
+	// announced with a general summary instead
+	Masked bool
+	// Not blocking time, e.g. marked as "free" or "transparent"
+	Free bool
+	// Declined by the owner of the calendar
+	Declined bool
+
+	Location    string
+	Description string
+	// Names or, if unknown, email addresses of the other attendees
+	Attendees []string
+	// How long before the start reminders are due
+	Reminders []time.Duration
+}
+
+// Provider fetches the events of a single calendar, e.g. from Google, a
+// CalDAV server or an iCalendar feed
+type Provider interface {
+	// Name of the calendar as used in announcements
+	Name() string
+	// Items returns all events overlapping the window from start to end.
+	// Recurring events are expanded into single occurrences.
+	Items(start time.Time, end time.Time) ([]Item, error)
+}
+
+// overlaps checks whether an event lies within the window from start to end.
+// Events without duration are within if they start within the window
+func overlaps(item Item, start time.Time, end time.Time) bool {
+	if !item.Start.Before(end) {
+		return false
+	}
+	if item.End.After(item.Start) {
+		return item.End.After(start)
+	}
+	return !item.Start.Before(start)
+}
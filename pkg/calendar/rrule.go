@@ -0,0 +1,334 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound of periods to look at, protecting against rules which never
+// produce an occurrence
+const maxPeriods = 10000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// rrule is a recurrence rule (RFC 5545, 3.3.10). Supported are the
+// frequencies DAILY, WEEKLY, MONTHLY and YEARLY with INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY, BYMONTH, BYSETPOS and WKST. BYDAY with an
+// ordinal like "-1FR" refers to the month. Rules with other parts like
+// BYWEEKNO or BYHOUR are rejected rather than expanded wrongly.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []int
+	bySetPos   []int
+	weekStart  time.Weekday
+}
+
+// weekdayNum is a weekday like "MO" or, with an ordinal, "2MO" (second
+// Monday) or "-1FR" (last Friday)
+type weekdayNum struct {
+	ordinal int
+	day     time.Weekday
+}
+
+func parseRRule(spec string, loc *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(spec, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			r.freq = value
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+		case "UNTIL":
+			r.until, _, err = parseICSTime(icsProperty{value: value})
+			if err == nil && len(value) == 8 {
+				// Dates include the whole day
+				r.until = time.Date(r.until.Year(), r.until.Month(), r.until.Day(), 23, 59, 59, 0, loc)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				var wd weekdayNum
+				if wd, err = parseWeekdayNum(day); err != nil {
+					break
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseInts(value)
+		case "BYMONTH":
+			r.byMonth, err = parseInts(value)
+		case "BYSETPOS":
+			r.bySetPos, err = parseInts(value)
+		case "WKST":
+			day, found := weekdays[value]
+			if !found {
+				err = fmt.Errorf("unknown weekday")
+			}
+			r.weekStart = day
+		default:
+			// Extensions can be ignored
+			if !strings.HasPrefix(key, "X-") {
+				return nil, fmt.Errorf("unsupported %s in recurrence rule", key)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s' in recurrence rule", key, value)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported frequency '%s' in recurrence rule", r.freq)
+	}
+	if r.interval < 1 {
+		return nil, fmt.Errorf("invalid interval %d in recurrence rule", r.interval)
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(value string) (weekdayNum, error) {
+	if len(value) < 2 {
+		return weekdayNum{}, fmt.Errorf("invalid weekday '%s'", value)
+	}
+	day, found := weekdays[value[len(value)-2:]]
+	if !found {
+		return weekdayNum{}, fmt.Errorf("invalid weekday '%s'", value)
+	}
+	wd := weekdayNum{day: day}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 {
+			return weekdayNum{}, fmt.Errorf("invalid weekday '%s'", value)
+		}
+		wd.ordinal = n
+	}
+	return wd, nil
+}
+
+func parseInts(value string) ([]int, error) {
+	ret := []int{}
+	for _, v := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+// occurrences returns the start times of the occurrences of an event
+// starting at dtstart, up to (excluding) limit. Occurrences before from
+// may be skipped
+func (r *rrule) occurrences(dtstart time.Time, from time.Time, limit time.Time) []time.Time {
+	ret := []time.Time{}
+	count := 0
+	first := r.firstPeriod(dtstart, from)
+	for period := first; period < first+maxPeriods; period++ {
+		candidates := r.candidates(dtstart, period*r.interval)
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) {
+				return ret
+			}
+			if !t.Before(limit) {
+				return ret
+			}
+			count++
+			if r.count > 0 && count > r.count {
+				return ret
+			}
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// firstPeriod returns the period from which on occurrences can start at
+// or after from. Without COUNT, earlier periods don't need to be looked at
+func (r *rrule) firstPeriod(dtstart time.Time, from time.Time) int {
+	if r.count > 0 || !from.After(dtstart) {
+		return 0
+	}
+	var n int
+	switch r.freq {
+	case "DAILY":
+		n = int(from.Sub(dtstart).Hours() / 24)
+	case "WEEKLY":
+		n = int(from.Sub(dtstart).Hours() / (24 * 7))
+	case "MONTHLY":
+		n = (from.Year()-dtstart.Year())*12 + int(from.Month()) - int(dtstart.Month())
+	case "YEARLY":
+		n = from.Year() - dtstart.Year()
+	}
+	// One period earlier, as the division rounds and time zones shift
+	n = n/r.interval - 1
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// candidates returns the sorted start times within the n-th period after
+// the one of dtstart
+func (r *rrule) candidates(dtstart time.Time, n int) []time.Time {
+	year, month, day := dtstart.Date()
+	days := []time.Time{}
+	switch r.freq {
+	case "DAILY":
+		days = append(days, date(year, month, day+n, dtstart))
+	case "WEEKLY":
+		offset := (int(dtstart.Weekday()) - int(r.weekStart) + 7) % 7
+		weekStart := date(year, month, day-offset+7*n, dtstart)
+		if len(r.byDay) == 0 {
+			days = append(days, date(year, month, day+7*n, dtstart))
+		}
+		for i := 0; i < 7 && len(r.byDay) > 0; i++ {
+			d := weekStart.AddDate(0, 0, i)
+			if r.matchesWeekday(d) {
+				days = append(days, d)
+			}
+		}
+	case "MONTHLY":
+		days = r.monthDays(date(year, month+time.Month(n), 1, dtstart), day)
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(month)}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(date(year+n, time.Month(m), 1, dtstart), day)...)
+		}
+	}
+
+	ret := []time.Time{}
+	for _, d := range days {
+		if r.matchesMonth(d) && (r.freq != "DAILY" || r.matchesMonthDay(d) && r.matchesWeekday(d)) {
+			ret = append(ret, d)
+		}
+	}
+	sort.Sort(byTime(ret))
+	return r.selectPositions(ret)
+}
+
+// selectPositions picks the candidates of a period given by BYSETPOS, like
+// 1 for the first or -1 for the last one
+func (r *rrule) selectPositions(candidates []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 {
+		return candidates
+	}
+	ret := []time.Time{}
+	for i, t := range candidates {
+		for _, pos := range r.bySetPos {
+			if pos == i+1 || pos == i-len(candidates) {
+				ret = append(ret, t)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// monthDays returns the days of the month starting at first matching
+// BYMONTHDAY and BYDAY or, without them, the given day of the month
+func (r *rrule) monthDays(first time.Time, day int) []time.Time {
+	days := []time.Time{}
+	length := daysIn(first)
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		// Months without the day are skipped
+		if day <= length {
+			days = append(days, first.AddDate(0, 0, day-1))
+		}
+		return days
+	}
+	for i := 0; i < length; i++ {
+		d := first.AddDate(0, 0, i)
+		if r.matchesMonthDay(d) && r.matchesWeekday(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+func (r *rrule) matchesMonth(t time.Time) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, m := range r.byMonth {
+		if time.Month(m) == t.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonthDay(t time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	length := daysIn(t)
+	for _, d := range r.byMonthDay {
+		if d == t.Day() || d < 0 && length+d+1 == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesWeekday(t time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, wd := range r.byDay {
+		if wd.day != t.Weekday() {
+			continue
+		}
+		if wd.ordinal == 0 || r.freq == "WEEKLY" || r.freq == "DAILY" {
+			return true
+		}
+		// Ordinals count the occurrences of the weekday within the month
+		if wd.ordinal > 0 && (t.Day()-1)/7+1 == wd.ordinal {
+			return true
+		}
+		if wd.ordinal < 0 && (daysIn(t)-t.Day())/7+1 == -wd.ordinal {
+			return true
+		}
+	}
+	return false
+}
+
+// date creates a time at the time of day of ref, normalizing the date
+func date(year int, month time.Month, day int, ref time.Time) time.Time {
+	return time.Date(year, month, day, ref.Hour(), ref.Minute(), ref.Second(), 0, ref.Location())
+}
+
+// daysIn returns the number of days of the month of t
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+type byTime []time.Time
+
+func (a byTime) Len() int           { return len(a) }
+func (a byTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byTime) Less(i, j int) bool { return a[i].Before(a[j]) }
@@ -0,0 +1,92 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrences(t *testing.T) {
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 17, 0, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		rule     string
+		start    time.Time
+		limit    time.Time
+		expected []time.Time
+	}{
+		// Last workday of the month
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", day(2017, 1, 31), day(2017, 5, 1),
+			[]time.Time{day(2017, 1, 31), day(2017, 2, 28), day(2017, 3, 31), day(2017, 4, 28)}},
+		// First and last day of the weekend
+		{"FREQ=MONTHLY;BYDAY=SA,SU;BYSETPOS=1,-1", day(2017, 3, 4), day(2017, 5, 1),
+			[]time.Time{day(2017, 3, 4), day(2017, 3, 26), day(2017, 4, 1), day(2017, 4, 30)}},
+		{"FREQ=MONTHLY;BYDAY=-1FR", day(2017, 1, 27), day(2017, 5, 1),
+			[]time.Time{day(2017, 1, 27), day(2017, 2, 24), day(2017, 3, 31), day(2017, 4, 28)}},
+		// Months without a 31st are skipped
+		{"FREQ=MONTHLY", day(2017, 1, 31), day(2017, 6, 1),
+			[]time.Time{day(2017, 1, 31), day(2017, 3, 31), day(2017, 5, 31)}},
+		{"FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", day(2017, 3, 26), day(2020, 1, 1),
+			[]time.Time{day(2017, 3, 26), day(2018, 3, 25), day(2019, 3, 31)}},
+		{"FREQ=WEEKLY;COUNT=3;BYDAY=TU,TH", day(2017, 3, 2), day(2018, 1, 1),
+			[]time.Time{day(2017, 3, 2), day(2017, 3, 7), day(2017, 3, 9)}},
+		// Dates include the whole day
+		{"FREQ=DAILY;UNTIL=20170304", day(2017, 3, 1), day(2018, 1, 1),
+			[]time.Time{day(2017, 3, 1), day(2017, 3, 2), day(2017, 3, 3), day(2017, 3, 4)}},
+		{"FREQ=DAILY;INTERVAL=3;X-APPLE-STRUCTURED=1", day(2017, 3, 1), day(2017, 3, 11),
+			[]time.Time{day(2017, 3, 1), day(2017, 3, 4), day(2017, 3, 7), day(2017, 3, 10)}},
+		// The examples of RFC 5545 for the start of the week
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO", day(1997, 8, 5), day(1998, 1, 1),
+			[]time.Time{day(1997, 8, 5), day(1997, 8, 10), day(1997, 8, 19), day(1997, 8, 24)}},
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU", day(1997, 8, 5), day(1998, 1, 1),
+			[]time.Time{day(1997, 8, 5), day(1997, 8, 17), day(1997, 8, 19), day(1997, 8, 31)}},
+	} {
+		r, err := parseRRule(c.rule, time.UTC)
+		if err != nil {
+			t.Errorf("%s: %v", c.rule, err)
+			continue
+		}
+		occurrences := r.occurrences(c.start, c.start, c.limit)
+		if len(occurrences) != len(c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.rule, c.expected, occurrences)
+			continue
+		}
+		for i, o := range occurrences {
+			if !o.Equal(c.expected[i]) {
+				t.Errorf("%s: expected %v, got %v", c.rule, c.expected, occurrences)
+				break
+			}
+		}
+	}
+}
+
+func TestOccurrencesKeepLocalTime(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	r, err := parseRRule("FREQ=DAILY", berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Across the change to daylight saving time on March 26
+	start := time.Date(2017, 3, 25, 19, 30, 0, 0, berlin)
+	occurrences := r.occurrences(start, start, start.AddDate(0, 0, 2))
+	if len(occurrences) != 2 || !occurrences[1].Equal(time.Date(2017, 3, 26, 19, 30, 0, 0, berlin)) {
+		t.Errorf("unexpected occurrences %v", occurrences)
+	}
+}
+
+func TestParseRRuleInvalid(t *testing.T) {
+	for _, rule := range []string{
+		"FREQ=YEARLY;BYWEEKNO=10;BYDAY=MO",
+		"FREQ=DAILY;BYHOUR=9,17",
+		"FREQ=HOURLY",
+		"BYDAY=MO",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYSETPOS=last",
+		"FREQ=WEEKLY;WKST=XX",
+	} {
+		if _, err := parseRRule(rule, time.UTC); err == nil {
+			t.Errorf("no error for %s", rule)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package calendar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is the time range for which events are queried
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+var (
+	daysPattern    = regexp.MustCompile(`^(\d+)d$`)
+	weekPattern    = regexp.MustCompile(`^(\d{4})-w(\d{2})(-we)?$`)
+	monthPattern   = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	weekdayPattern = regexp.MustCompile(`^(next-)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday)$`)
+)
+
+// Longest window which can be queried
+const maxWindowDays = 366
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// ParseWindow parses the description of a window relative to now. Windows
+// including now start at now, so that past events are left out. Known are
+//
+//	today, tomorrow     the (rest of the) day
+//	week, next-week     the rest of this week or the next week (Monday to Sunday)
+//	weekend             the coming or current weekend
+//	monday, next-monday the coming Monday (today if it's Monday) or the one after
+//	7d                  the next seven days, starting today
+//	2017-06-24          a date
+//	2017-06-24..2017-06-26 the dates from the first to the last one
+//	2017-W25, 2017-W25-WE, 2017-06  a week, its weekend and a month as sent by Alexa
+//
+// Windows can't be longer than a year.
+func ParseWindow(spec string, now time.Time) (Window, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	today := midnight(now)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+
+	switch spec {
+	case "today", "":
+		return window(now, today, 1), nil
+	case "tomorrow":
+		return window(now, today.AddDate(0, 0, 1), 1), nil
+	case "week":
+		return window(now, monday, 7), nil
+	case "next-week":
+		return window(now, monday.AddDate(0, 0, 7), 7), nil
+	case "weekend":
+		return window(now, monday.AddDate(0, 0, 5), 2), nil
+	}
+
+	if m := daysPattern.FindStringSubmatch(spec); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > maxWindowDays {
+			return Window{}, fmt.Errorf("invalid number of days in '%s', must be 1 to %d", spec, maxWindowDays)
+		}
+		return window(now, today, n), nil
+	}
+	if m := weekdayPattern.FindStringSubmatch(spec); m != nil {
+		offset := (int(weekdayNames[m[2]]) - int(today.Weekday()) + 7) % 7
+		if m[1] != "" {
+			offset += 7
+		}
+		return window(now, today.AddDate(0, 0, offset), 1), nil
+	}
+	if m := weekPattern.FindStringSubmatch(spec); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		week, _ := strconv.Atoi(m[2])
+		if _, weeks := time.Date(year, time.December, 28, 0, 0, 0, 0, now.Location()).ISOWeek(); week < 1 || week > weeks {
+			return Window{}, fmt.Errorf("invalid week in '%s', %d has %d weeks", spec, year, weeks)
+		}
+		start := isoWeekStart(year, week, now.Location())
+		if m[3] != "" {
+			return window(now, start.AddDate(0, 0, 5), 2), nil
+		}
+		return window(now, start, 7), nil
+	}
+	if m := monthPattern.FindStringSubmatch(spec); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 {
+			return Window{}, fmt.Errorf("invalid month in '%s'", spec)
+		}
+		start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, now.Location())
+		return window(now, start, daysIn(start)), nil
+	}
+	if parts := strings.SplitN(spec, "..", 2); len(parts) == 2 {
+		first, err := time.ParseInLocation("2006-01-02", parts[0], now.Location())
+		if err != nil {
+			return Window{}, fmt.Errorf("invalid date in '%s'", spec)
+		}
+		last, err := time.ParseInLocation("2006-01-02", parts[1], now.Location())
+		if err != nil || last.Before(first) {
+			return Window{}, fmt.Errorf("invalid date in '%s'", spec)
+		}
+		days := int(last.Sub(first).Hours()/24+0.5) + 1
+		if days > maxWindowDays {
+			return Window{}, fmt.Errorf("time range '%s' is longer than %d days", spec, maxWindowDays)
+		}
+		return window(now, first, days), nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", spec, now.Location()); err == nil {
+		return window(now, day, 1), nil
+	}
+	return Window{}, fmt.Errorf("unknown time range '%s'", spec)
+}
+
+// window creates a window of the given number of days, starting at now if
+// this is within the window
+func window(now time.Time, start time.Time, days int) Window {
+	w := Window{start, start.AddDate(0, 0, days)}
+	if now.After(w.Start) && now.Before(w.End) {
+		w.Start = now
+	}
+	return w
+}
+
+// isoWeekStart returns the Monday of an ISO week
+func isoWeekStart(year int, week int, loc *time.Location) time.Time {
+	// January 4th is always in the first week
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+	monday := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7)
+	return monday.AddDate(0, 0, 7*(week-1))
+}
+
+func midnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,113 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindowOnEveryWeekday(t *testing.T) {
+	// March 6th 2017 is a Monday
+	day := func(offset int) time.Time {
+		return time.Date(2017, 3, 6+offset, 0, 0, 0, 0, time.UTC)
+	}
+	for i := 0; i < 7; i++ {
+		now := day(i).Add(10 * time.Hour)
+		weekend := Window{day(5), day(7)}
+		if i >= 5 {
+			weekend.Start = now
+		}
+		for _, c := range []struct {
+			spec     string
+			expected Window
+		}{
+			{"today", Window{now, day(i + 1)}},
+			{"", Window{now, day(i + 1)}},
+			{"tomorrow", Window{day(i + 1), day(i + 2)}},
+			{"week", Window{now, day(7)}},
+			{"next-week", Window{day(7), day(14)}},
+			{"weekend", weekend},
+		} {
+			w, err := ParseWindow(c.spec, now)
+			if err != nil {
+				t.Errorf("%s on %s: %v", c.spec, now.Weekday(), err)
+				continue
+			}
+			if !w.Start.Equal(c.expected.Start) || !w.End.Equal(c.expected.End) {
+				t.Errorf("%s on %s: expected %v - %v, got %v - %v", c.spec, now.Weekday(), c.expected.Start, c.expected.End, w.Start, w.End)
+			}
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	monday := date(2017, 3, 6).Add(10 * time.Hour)
+	wednesday := date(2017, 3, 8).Add(10 * time.Hour)
+	for _, c := range []struct {
+		spec     string
+		now      time.Time
+		expected Window
+	}{
+		{"monday", monday, Window{monday, date(2017, 3, 7)}},
+		{"next-monday", monday, Window{date(2017, 3, 13), date(2017, 3, 14)}},
+		{"Tuesday", monday, Window{date(2017, 3, 7), date(2017, 3, 8)}},
+		{"monday", wednesday, Window{date(2017, 3, 13), date(2017, 3, 14)}},
+		{"next-friday", wednesday, Window{date(2017, 3, 17), date(2017, 3, 18)}},
+		{"7d", wednesday, Window{wednesday, date(2017, 3, 15)}},
+		{"366d", wednesday, Window{wednesday, date(2018, 3, 9)}},
+		// Dates as sent by Alexa
+		{"2017-03-10", wednesday, Window{date(2017, 3, 10), date(2017, 3, 11)}},
+		{"2017-03-08", wednesday, Window{wednesday, date(2017, 3, 9)}},
+		{"2017-W10", wednesday, Window{wednesday, date(2017, 3, 13)}},
+		{"2017-W11", wednesday, Window{date(2017, 3, 13), date(2017, 3, 20)}},
+		{"2017-W10-WE", wednesday, Window{date(2017, 3, 11), date(2017, 3, 13)}},
+		{"2017-06", wednesday, Window{date(2017, 6, 1), date(2017, 7, 1)}},
+		{"2017-03", wednesday, Window{wednesday, date(2017, 4, 1)}},
+		// The first week may start in the year before
+		{"2016-W01", wednesday, Window{date(2016, 1, 4), date(2016, 1, 11)}},
+		{"2020-W01", wednesday, Window{date(2019, 12, 30), date(2020, 1, 6)}},
+		{"2015-W53", wednesday, Window{date(2015, 12, 28), date(2016, 1, 4)}},
+		{"2020-W53-WE", wednesday, Window{date(2021, 1, 2), date(2021, 1, 4)}},
+		{"2017-06-24..2017-06-26", wednesday, Window{date(2017, 6, 24), date(2017, 6, 27)}},
+		{"2017-03-01..2017-03-09", wednesday, Window{wednesday, date(2017, 3, 10)}},
+		{"2017-01-01..2017-12-31", wednesday, Window{wednesday, date(2018, 1, 1)}},
+	} {
+		w, err := ParseWindow(c.spec, c.now)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if !w.Start.Equal(c.expected.Start) || !w.End.Equal(c.expected.End) {
+			t.Errorf("%s on %s: expected %v - %v, got %v - %v", c.spec, c.now.Weekday(), c.expected.Start, c.expected.End, w.Start, w.End)
+		}
+	}
+}
+
+func TestParseWindowInvalid(t *testing.T) {
+	now := time.Date(2017, 3, 8, 10, 0, 0, 0, time.UTC)
+	for _, spec := range []string{
+		"yesterday",
+		"next-weekend",
+		"0d",
+		"367d",
+		"100000d",
+		"99999999999999999999d",
+		"2017-13",
+		"2017-00",
+		"2017-W00",
+		"2017-W53",
+		"2020-W54",
+		"2017",
+		"2017-WI",
+		"2017-02-30",
+		"2017-06-26..2017-06-24",
+		"2017-01-01..2018-01-02",
+		"2017-06-24..",
+	} {
+		if _, err := ParseWindow(spec, now); err == nil {
+			t.Errorf("no error for '%s'", spec)
+		}
+	}
+}
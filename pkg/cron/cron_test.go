@@ -0,0 +1,160 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2017, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		spec     string
+		from     time.Time
+		expected []time.Time
+	}{
+		{"*/15 * * * *", at(3, 1, 10, 7), []time.Time{at(3, 1, 10, 15), at(3, 1, 10, 30)}},
+		// Seconds are ignored, the time itself never matches
+		{"30 10 * * *", time.Date(2017, 3, 1, 10, 29, 59, 0, time.UTC), []time.Time{at(3, 1, 10, 30), at(3, 2, 10, 30)}},
+		{"5/20 * * * *", at(3, 1, 10, 30), []time.Time{at(3, 1, 10, 45), at(3, 1, 11, 5)}},
+		{"10-20/5 8 * * *", at(3, 1, 8, 12), []time.Time{at(3, 1, 8, 15), at(3, 1, 8, 20), at(3, 2, 8, 10)}},
+		{"0 7,19 * * *", at(3, 1, 8, 0), []time.Time{at(3, 1, 19, 0), at(3, 2, 7, 0)}},
+		// March 3rd is a Friday
+		{"0 7 * * mon-fri", at(3, 3, 8, 0), []time.Time{at(3, 6, 7, 0), at(3, 7, 7, 0)}},
+		{"0 12 * * SUN", at(3, 1, 0, 0), []time.Time{at(3, 5, 12, 0), at(3, 12, 12, 0)}},
+		{"0 12 * * 7", at(3, 1, 0, 0), []time.Time{at(3, 5, 12, 0), at(3, 12, 12, 0)}},
+		{"0 0 1 */3 *", at(3, 1, 10, 0), []time.Time{at(4, 1, 0, 0), at(7, 1, 0, 0)}},
+		{"0 0 1 jan-mar,Dec *", at(3, 1, 10, 0), []time.Time{at(12, 1, 0, 0), time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		// Day of month or day of week if both are given: the first week or Mondays
+		{"0 9 1-3 * mon", at(3, 3, 10, 0), []time.Time{at(3, 6, 9, 0), at(3, 13, 9, 0), at(3, 20, 9, 0)}},
+		{"0 9 1-3 * mon", at(3, 27, 10, 0), []time.Time{at(4, 1, 9, 0), at(4, 2, 9, 0), at(4, 3, 9, 0)}},
+		// Both at once if only one is given
+		{"0 9 1-3 * ?", at(3, 3, 10, 0), []time.Time{at(4, 1, 9, 0), at(4, 2, 9, 0)}},
+		{"0 9 * * mon", at(3, 3, 10, 0), []time.Time{at(3, 6, 9, 0), at(3, 13, 9, 0)}},
+		{"@weekly", at(3, 1, 10, 0), []time.Time{at(3, 5, 0, 0), at(3, 12, 0, 0)}},
+		{"@Hourly", at(3, 1, 10, 0), []time.Time{at(3, 1, 11, 0), at(3, 1, 12, 0)}},
+		{"0 0 29 2 *", at(3, 1, 10, 0), []time.Time{time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)}},
+		// Never
+		{"0 0 30 2 *", at(3, 1, 10, 0), []time.Time{{}}},
+	} {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		next := c.from
+		for _, expected := range c.expected {
+			next = s.Next(next)
+			if !next.Equal(expected) {
+				t.Errorf("%s after %v: expected %v, got %v", c.spec, c.from, expected, next)
+				break
+			}
+		}
+	}
+}
+
+func TestNextDaylightSavingTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2017, month, day, hour, minute, 0, 0, berlin)
+	}
+	for _, c := range []struct {
+		spec     string
+		from     time.Time
+		expected []time.Time
+	}{
+		// The same time of day before and after the change
+		{"0 7 * * *", at(3, 25, 8, 0), []time.Time{at(3, 26, 7, 0), at(3, 27, 7, 0)}},
+		{"0 7 * * *", at(10, 28, 8, 0), []time.Time{at(10, 29, 7, 0), at(10, 30, 7, 0)}},
+		// 2:30 doesn't exist on March 26th
+		{"30 2 * * *", at(3, 25, 8, 0), []time.Time{at(3, 27, 2, 30)}},
+		{"*/30 * * * *", at(3, 26, 1, 15), []time.Time{at(3, 26, 1, 30), at(3, 26, 3, 0), at(3, 26, 3, 30)}},
+		// and is passed twice on October 29th, but runs only once
+		{"30 2 * * *", at(10, 29, 0, 0), []time.Time{at(10, 29, 2, 30), at(10, 30, 2, 30)}},
+		// Steps continue through the repeated hour
+		{"*/30 * * * *", at(10, 29, 1, 45), []time.Time{
+			time.Date(2017, 10, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2017, 10, 29, 0, 30, 0, 0, time.UTC),
+			time.Date(2017, 10, 29, 1, 0, 0, 0, time.UTC),
+		}},
+	} {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := c.from
+		for _, expected := range c.expected {
+			next = s.Next(next)
+			if !next.Equal(expected) {
+				t.Errorf("%s after %v: expected %v, got %v", c.spec, c.from, expected, next)
+				break
+			}
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@reboot",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * * monday",
+		"* * * foo *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1,,2 * * * *",
+		"-1 * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("no error for '%s'", spec)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2017, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		spec      string
+		at        time.Time
+		contains  bool
+		continues bool
+	}{
+		{"08:00-12:00", at(8, 0), true, false},
+		{"08:00-12:00", at(12, 0), false, false},
+		{"08:00-12:00", at(7, 59), false, false},
+		{"22:00-07:00", at(23, 0), true, false},
+		{"22:00-07:00", at(6, 59), true, true},
+		{"22:00-07:00", at(7, 0), false, false},
+		{"22:00-24:00", at(23, 59), true, false},
+	} {
+		w, err := ParseWindow(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if w.Contains(c.at) != c.contains || w.Continues(c.at) != c.continues {
+			t.Errorf("%s at %s: expected %v/%v, got %v/%v", c.spec, c.at.Format("15:04"),
+				c.contains, c.continues, w.Contains(c.at), w.Continues(c.at))
+		}
+	}
+
+	for _, spec := range []string{"22:00", "22-07", "25:00-07:00", "22:00-07:60", "24:30-07:00"} {
+		if _, err := ParseWindow(spec); err == nil {
+			t.Errorf("no error for '%s'", spec)
+		}
+	}
+}
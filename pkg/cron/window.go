@@ -0,0 +1,73 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time window like "22:00-07:00". Windows whose end is
+// before their start span midnight
+type Window struct {
+	start, end int
+}
+
+// ParseWindow parses a window given as "HH:MM-HH:MM"
+func ParseWindow(spec string) (*Window, error) {
+	parts := strings.Split(strings.TrimSpace(spec), "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("time window '%s' must have the format HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &Window{start, end}, nil
+}
+
+// ParseWindows parses a list of windows
+func ParseWindows(specs []string) ([]*Window, error) {
+	windows := []*Window{}
+	for _, spec := range specs {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// Contains checks whether the time of day of t lies within the window
+func (w *Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// Continues checks whether the time of day of t lies in the part after
+// midnight of a window spanning midnight
+func (w *Window) Continues(t time.Time) bool {
+	return w.start > w.end && t.Hour()*60+t.Minute() < w.end
+}
+
+func (w *Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+func parseClock(clock string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(strings.TrimSpace(clock), "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("invalid time '%s', must be HH:MM", clock)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || hour == 24 && minute != 0 {
+		return 0, fmt.Errorf("invalid time '%s'", clock)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,63 @@
+package failure
+
+import "fmt"
+
+// Error tells why an operation failed. Kind is one of the errors declared
+// by the package for telling failures apart, like ErrAuth
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// New creates an error of the given kind
+func New(kind error, err error) *Error {
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Cause returns the kind of the error
+func (e *Error) Cause() error {
+	return e.Kind
+}
+
+// wrapped is an error with context which keeps its cause
+type wrapped struct {
+	msg string
+	err error
+}
+
+func (w *wrapped) Error() string {
+	return w.msg + ": " + w.err.Error()
+}
+
+// Cause returns the wrapped error
+func (w *wrapped) Cause() error {
+	return w.err
+}
+
+// Wrapf adds context to an error like fmt.Errorf with "%v", but the kind
+// of the error can still be found with Kind
+func Wrapf(err error, format string, args ...interface{}) error {
+	return &wrapped{fmt.Sprintf(format, args...), err}
+}
+
+// Kind follows the causes of an error and returns the innermost one, which
+// is the kind of an *Error. Errors without a cause are returned as they are
+func Kind(err error) error {
+	for {
+		c, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return err
+		}
+		cause := c.Cause()
+		if cause == nil || cause == err {
+			return err
+		}
+		err = cause
+	}
+}
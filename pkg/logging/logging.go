@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+// Levels in increasing severity
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level given by its name
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return Warn, nil
+	}
+	return Info, fmt.Errorf("unknown log level '%s' (debug, info, warn or error)", name)
+}
+
+// Output formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+var (
+	mutex  sync.Mutex
+	level            = Info
+	format           = FormatLogfmt
+	output io.Writer = os.Stderr
+)
+
+// SetLevel sets the minimal level of messages to log
+func SetLevel(l Level) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	level = l
+}
+
+// SetFormat selects the output format, "logfmt" or "json"
+func SetFormat(f string) error {
+	if f != FormatLogfmt && f != FormatJSON {
+		return fmt.Errorf("unknown log format '%s' (logfmt or json)", f)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	format = f
+	return nil
+}
+
+// SetOutput sets where messages are written to, stderr by default
+func SetOutput(w io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	output = w
+}
+
+// Logger logs the messages of a subsystem
+type Logger struct {
+	subsystem string
+}
+
+// New creates a logger for a subsystem like "watch" or "speak"
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// Debugf logs details which are only of interest when looking for problems
+func (l *Logger) Debugf(msg string, args ...interface{}) {
+	l.log(Debug, msg, args)
+}
+
+// Infof logs what is going on
+func (l *Logger) Infof(msg string, args ...interface{}) {
+	l.log(Info, msg, args)
+}
+
+// Warnf logs problems which can be dealt with
+func (l *Logger) Warnf(msg string, args ...interface{}) {
+	l.log(Warn, msg, args)
+}
+
+// Errorf logs failures
+func (l *Logger) Errorf(msg string, args ...interface{}) {
+	l.log(Error, msg, args)
+}
+
+// Enabled checks whether messages of a level are logged
+func (l *Logger) Enabled(lvl Level) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return lvl >= level
+}
+
+// Writer returns a writer which logs every line written at the given level,
+// e.g. for redirecting the standard logger
+func (l *Logger) Writer(lvl Level) io.Writer {
+	return &lineWriter{logger: l, level: lvl}
+}
+
+func (l *Logger) log(lvl Level, msg string, args []interface{}) {
+	if !l.Enabled(lvl) {
+		return
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	msg = Redact(strings.TrimRight(msg, "\n"))
+	now := time.Now().Format(time.RFC3339)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if format == FormatJSON {
+		line, _ := json.Marshal(map[string]string{
+			"time":      now,
+			"level":     lvl.String(),
+			"subsystem": l.subsystem,
+			"msg":       msg,
+		})
+		fmt.Fprintf(output, "%s\n", line)
+		return
+	}
+	fmt.Fprintf(output, "time=%s level=%s subsystem=%s msg=%s\n", now, lvl, l.subsystem, quote(msg))
+}
+
+// quote quotes a logfmt value if needed
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " =\"\t\n\\") {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+type lineWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.logger.log(w.level, "%s", []interface{}{line})
+	}
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Replacement for redacted values
+const redacted = "***"
+
+var (
+	secretsMutex sync.Mutex
+	secrets      = map[string]bool{}
+)
+
+// Values of assignments to keys like "password" in key=value, key: value or
+// JSON notation, credentials in URLs and bearer tokens
+var redactPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{
+		regexp.MustCompile(`(?i)("?[a-z_]*(?:password|passwd|secret|token|api_?key)"?\s*[:=]\s*"?)[^\s"&,;}]+`),
+		"${1}" + redacted,
+	},
+	// InfluxDB credentials in query parameters
+	{regexp.MustCompile(`([?&][up]=)[^&\s"]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(://[^/:@\s]+:)[^@/\s]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[^\s"]+`), "${1}" + redacted},
+	// AWS access key ids
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), redacted},
+}
+
+// Secret registers values, e.g. passwords from the configuration, which are
+// replaced wherever they appear in a log message. Values shorter than four
+// characters are not registered, as they would redact too much. They are
+// only redacted where they match one of the patterns
+func Secret(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, value := range values {
+		if len(value) >= 4 {
+			secrets[value] = true
+		}
+	}
+}
+
+// Redact removes passwords, tokens and other secrets from a message
+func Redact(msg string) string {
+	secretsMutex.Lock()
+	for secret := range secrets {
+		msg = strings.Replace(msg, secret, redacted, -1)
+	}
+	secretsMutex.Unlock()
+
+	for _, p := range redactPatterns {
+		msg = p.pattern.ReplaceAllString(msg, p.replacement)
+	}
+	return msg
+}
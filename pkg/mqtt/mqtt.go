@@ -0,0 +1,346 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options for connecting to an MQTT broker
+type Options struct {
+	// Broker URL like tcp://localhost:1883
+	Broker   string
+	ClientID string
+	User     string
+	Password string
+}
+
+// Message received for a subscription
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Client is a minimal MQTT 3.1.1 client which can only subscribe
+// with QoS 0 and publish with QoS 0
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+	done   chan struct{}
+	// Messages received while waiting for the SUBACK
+	pending []*Message
+}
+
+const keepAlive = 60 * time.Second
+
+// How long to wait for the CONNACK and SUBACK
+const ackTimeout = 10 * time.Second
+
+// Largest packet accepted from the broker, as its length is announced by the
+// broker. Messages for triggers are short
+const maxPacketLength = 1024 * 1024
+
+// How long to wait for any packet from the broker. As a ping is sent every
+// half keepAlive, the PINGRESP arrives well within, unless the connection
+// has broken without being closed
+const readTimeout = keepAlive * 3 / 2
+
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	flagsSubscribe    = 0x02
+	protocolLevel     = 4
+	connectCleanStart = 0x02
+	connectPassword   = 0x40
+	connectUser       = 0x80
+)
+
+// Connect opens a connection to the broker
+func Connect(options *Options) (*Client, error) {
+	address := options.Broker
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "tcp" && u.Scheme != "mqtt" {
+			return nil, fmt.Errorf("unsupported MQTT scheme %s", u.Scheme)
+		}
+		address = u.Host
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "1883")
+	}
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return connect(conn, options)
+}
+
+// connect sends the CONNECT packet over the connection and waits for the
+// broker to accept it
+func connect(conn net.Conn, options *Options) (*Client, error) {
+	c := &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		done:   make(chan struct{}),
+	}
+
+	var body bytes.Buffer
+	writeString(&body, "MQTT")
+	flags := byte(connectCleanStart)
+	if options.User != "" {
+		flags |= connectUser
+	}
+	if options.Password != "" {
+		flags |= connectPassword
+	}
+	body.Write([]byte{protocolLevel, flags, byte(keepAlive / time.Second >> 8), byte(keepAlive / time.Second & 0xff)})
+	writeString(&body, options.ClientID)
+	if options.User != "" {
+		writeString(&body, options.User)
+	}
+	if options.Password != "" {
+		writeString(&body, options.Password)
+	}
+	if err := c.write(packetConnect<<4, body.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	kind, payload, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if kind>>4 != packetConnack || len(payload) < 2 {
+		conn.Close()
+		return nil, errors.New("no CONNACK received from broker")
+	}
+	if payload[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("connection refused by broker (code %d)", payload[1])
+	}
+	go c.ping()
+	return c, nil
+}
+
+// Subscribe subscribes to the given topic filters and waits for the broker
+// to acknowledge them. It fails if the broker refuses any of them. Messages
+// can be received with Receive afterwards
+func (c *Client) Subscribe(topics ...string) error {
+	var body bytes.Buffer
+	body.Write([]byte{0, 1})
+	for _, topic := range topics {
+		writeString(&body, topic)
+		body.WriteByte(0)
+	}
+	if err := c.write(packetSubscribe<<4|flagsSubscribe, body.Bytes()); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	for {
+		kind, payload, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch kind >> 4 {
+		case packetPublish:
+			// Retained messages may arrive before the SUBACK
+			msg, err := c.message(kind, payload)
+			if err != nil {
+				return err
+			}
+			c.pending = append(c.pending, msg)
+			continue
+		case packetSuback:
+		default:
+			continue
+		}
+		if len(payload) != 2+len(topics) || payload[0] != 0 || payload[1] != 1 {
+			return errors.New("invalid SUBACK received from broker")
+		}
+		for i, code := range payload[2:] {
+			if code&0x80 != 0 {
+				return fmt.Errorf("subscription to %s refused by broker", topics[i])
+			}
+		}
+		return nil
+	}
+}
+
+// Publish sends a message with QoS 0
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var body bytes.Buffer
+	writeString(&body, topic)
+	body.Write(payload)
+	kind := byte(packetPublish << 4)
+	if retain {
+		kind |= 0x01
+	}
+	return c.write(kind, body.Bytes())
+}
+
+// Receive blocks until the next published message arrives. It fails if
+// nothing, not even a PINGRESP, has been received within readTimeout
+func (c *Client) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		kind, payload, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if kind>>4 == packetPublish {
+			return c.message(kind, payload)
+		}
+	}
+}
+
+// message decodes a PUBLISH packet, acknowledging it for QoS 1
+func (c *Client) message(kind byte, payload []byte) (*Message, error) {
+	if len(payload) < 2 {
+		return nil, errors.New("invalid PUBLISH packet")
+	}
+	topicLen := int(payload[0])<<8 | int(payload[1])
+	if len(payload) < 2+topicLen {
+		return nil, errors.New("invalid PUBLISH packet")
+	}
+	msg := &Message{Topic: string(payload[2 : 2+topicLen])}
+	rest := payload[2+topicLen:]
+	if qos := (kind >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return nil, errors.New("invalid PUBLISH packet")
+		}
+		if qos == 1 {
+			if err := c.write(packetPuback<<4, rest[:2]); err != nil {
+				return nil, err
+			}
+		}
+		rest = rest[2:]
+	}
+	msg.Payload = rest
+	return msg, nil
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	close(c.done)
+	c.write(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+// Match checks whether a topic matches a filter with the wildcards + and #
+func Match(filter string, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "+" && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
+
+func (c *Client) ping() {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(packetPingreq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) write(kind byte, body []byte) error {
+	var packet bytes.Buffer
+	packet.WriteByte(kind)
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet.WriteByte(b)
+		if length == 0 {
+			break
+		}
+	}
+	packet.Write(body)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err := c.conn.Write(packet.Bytes())
+	return err
+}
+
+func (c *Client) read() (byte, []byte, error) {
+	kind, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("invalid packet length")
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketLength {
+		return 0, nil, fmt.Errorf("packet of %d bytes exceeds the limit of %d bytes", length, maxPacketLength)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return kind, payload, nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.Write([]byte{byte(len(s) >> 8), byte(len(s) & 0xff)})
+	buf.WriteString(s)
+}
@@ -0,0 +1,248 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeBroker runs the script as broker for a client connecting over the
+// returned connection. The result of the script is sent on the channel
+func fakeBroker(script func(b *Client) error) (net.Conn, <-chan error) {
+	clientConn, brokerConn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		defer brokerConn.Close()
+		errs <- script(&Client{conn: brokerConn, reader: bufio.NewReader(brokerConn)})
+	}()
+	return clientConn, errs
+}
+
+// expect reads the next packet, which must be of the given type
+func expect(b *Client, packet byte) ([]byte, error) {
+	kind, payload, err := b.read()
+	if err != nil {
+		return nil, err
+	}
+	if kind>>4 != packet {
+		return nil, fmt.Errorf("expected packet type %d, got %d", packet, kind>>4)
+	}
+	return payload, nil
+}
+
+// accept answers the CONNECT packet with the given return code
+func accept(b *Client, code byte) error {
+	if _, err := expect(b, packetConnect); err != nil {
+		return err
+	}
+	return b.write(packetConnack<<4, []byte{0, code})
+}
+
+// publishPacket returns the body of a PUBLISH packet
+func publishPacket(topic string, packetID []byte, payload string) []byte {
+	var body bytes.Buffer
+	writeString(&body, topic)
+	body.Write(packetID)
+	body.WriteString(payload)
+	return body.Bytes()
+}
+
+var testOptions = &Options{ClientID: "kitchen", User: "puffer", Password: "secret"}
+
+func TestConnect(t *testing.T) {
+	conn, errs := fakeBroker(func(b *Client) error {
+		payload, err := expect(b, packetConnect)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(payload, []byte("\x00\x04MQTT\x04")) || payload[7] != connectCleanStart|connectUser|connectPassword {
+			return fmt.Errorf("invalid CONNECT %q", payload)
+		}
+		if !bytes.HasSuffix(payload, []byte("\x00\x07kitchen\x00\x06puffer\x00\x06secret")) {
+			return fmt.Errorf("invalid credentials in CONNECT %q", payload)
+		}
+		return b.write(packetConnack<<4, []byte{0, 0})
+	})
+	client, err := connect(conn, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	// Not authorized
+	conn, errs := fakeBroker(func(b *Client) error { return accept(b, 5) })
+	client, err := connect(conn, testOptions)
+	if err == nil {
+		client.Close()
+		t.Fatal("refused connection accepted")
+	}
+	if !strings.Contains(err.Error(), "code 5") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+
+	conn, _ = fakeBroker(func(b *Client) error {
+		if _, err := expect(b, packetConnect); err != nil {
+			return err
+		}
+		return b.write(packetPingresp<<4, nil)
+	})
+	if _, err := connect(conn, testOptions); err == nil || !strings.Contains(err.Error(), "CONNACK") {
+		t.Errorf("expected missing CONNACK, got %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	conn, errs := fakeBroker(func(b *Client) error {
+		if err := accept(b, 0); err != nil {
+			return err
+		}
+		kind, payload, err := b.read()
+		if err != nil {
+			return err
+		}
+		if kind != packetSubscribe<<4|flagsSubscribe || string(payload) != "\x00\x01\x00\x0apuffer/dnd\x00\x00\x07alarm/#\x00" {
+			return fmt.Errorf("invalid SUBSCRIBE %x %q", kind, payload)
+		}
+		// A retained message may arrive before the SUBACK
+		if err := b.write(packetPublish<<4|0x01, publishPacket("puffer/dnd", nil, "on")); err != nil {
+			return err
+		}
+		return b.write(packetSuback<<4, []byte{0, 1, 0, 1})
+	})
+	client, err := connect(conn, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Subscribe("puffer/dnd", "alarm/#"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	msg, err := client.Receive()
+	if err != nil || msg.Topic != "puffer/dnd" || string(msg.Payload) != "on" {
+		t.Errorf("retained message lost: %v (%v)", msg, err)
+	}
+}
+
+func TestSubscribeRefused(t *testing.T) {
+	for _, c := range []struct {
+		suback []byte
+		err    string
+	}{
+		{[]byte{0, 1, 0, 0x80}, "subscription to alarm/# refused"},
+		// Return codes missing
+		{[]byte{0, 1, 0}, "invalid SUBACK"},
+		// Another packet identifier
+		{[]byte{0, 2, 0, 0}, "invalid SUBACK"},
+	} {
+		suback := c.suback
+		conn, _ := fakeBroker(func(b *Client) error {
+			if err := accept(b, 0); err != nil {
+				return err
+			}
+			if _, err := expect(b, packetSubscribe); err != nil {
+				return err
+			}
+			return b.write(packetSuback<<4, suback)
+		})
+		client, err := connect(conn, testOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Subscribe("puffer/dnd", "alarm/#"); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("SUBACK %v: expected error %q, got %v", suback, c.err, err)
+		}
+		client.Close()
+	}
+}
+
+func TestReceiveAcknowledgesQoS1(t *testing.T) {
+	conn, errs := fakeBroker(func(b *Client) error {
+		if err := accept(b, 0); err != nil {
+			return err
+		}
+		if err := b.write(packetPublish<<4|0x02, publishPacket("alarm/door", []byte{0x12, 0x34}, "open")); err != nil {
+			return err
+		}
+		payload, err := expect(b, packetPuback)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(payload, []byte{0x12, 0x34}) {
+			return fmt.Errorf("PUBACK for packet %x", payload)
+		}
+		return nil
+	})
+	client, err := connect(conn, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	msg, err := client.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Topic != "alarm/door" || string(msg.Payload) != "open" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReceiveRejectsLargePackets(t *testing.T) {
+	conn, _ := fakeBroker(func(b *Client) error {
+		if err := accept(b, 0); err != nil {
+			return err
+		}
+		// PUBLISH announcing 256 MB
+		_, err := b.conn.Write([]byte{packetPublish << 4, 0xff, 0xff, 0xff, 0x7f})
+		return err
+	})
+	client, err := connect(conn, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if msg, err := client.Receive(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expected packet to be rejected, got %v (%v)", msg, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		filter  string
+		topic   string
+		matches bool
+	}{
+		{"puffer/dnd", "puffer/dnd", true},
+		{"puffer/dnd", "puffer/dnd/set", false},
+		{"puffer/dnd/set", "puffer/dnd", false},
+		{"puffer/+", "puffer/dnd", true},
+		{"puffer/+", "puffer/dnd/set", false},
+		{"+/dnd", "puffer/dnd", true},
+		{"puffer/+/set", "puffer/dnd/set", true},
+		{"puffer/#", "puffer/dnd/set", true},
+		{"puffer/#", "puffer", true},
+		{"#", "alarm/door", true},
+		{"alarm/#", "puffer/dnd", false},
+		{"Puffer/dnd", "puffer/dnd", false},
+	} {
+		if matches := Match(c.filter, c.topic); matches != c.matches {
+			t.Errorf("%s on %s: expected %v, got %v", c.filter, c.topic, c.matches, matches)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package netif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Where Linux exposes the capabilities of this process
+const statusFile = "/proc/self/status"
+
+// Bit of CAP_NET_RAW in the capability sets
+const capNetRaw = 13
+
+// CheckCapture checks whether this process may capture packets, which
+// requires CAP_NET_RAW on Linux. On other systems nothing is checked.
+func CheckCapture() error {
+	file, err := os.Open(statusFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	caps, err := ParseEffectiveCaps(file)
+	if err != nil {
+		return err
+	}
+	if caps&(1<<capNetRaw) == 0 {
+		binary, _ := os.Executable()
+		if binary == "" {
+			binary = "puffer"
+		}
+		return fmt.Errorf(`capturing packets requires the capability CAP_NET_RAW, which this process doesn't have.
+Either grant it to the binary with
+
+    sudo setcap cap_net_raw,cap_net_admin=eip %s
+
+or detect button presses without capturing packets from the log of the DHCP
+server by configuring "detection.log" or "detection.syslog"`, binary)
+	}
+	return nil
+}
+
+// ParseEffectiveCaps returns the effective capabilities from a process
+// status in the format of /proc/<pid>/status
+func ParseEffectiveCaps(status io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "CapEff:" {
+			caps, err := strconv.ParseUint(fields[1], 16, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid effective capabilities '%s'", fields[1])
+			}
+			return caps, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no effective capabilities found in process status")
+}
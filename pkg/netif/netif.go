@@ -0,0 +1,205 @@
+package netif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Where Linux exposes its routing tables
+const (
+	routeFile  = "/proc/net/route"
+	route6File = "/proc/net/ipv6_route"
+)
+
+// Candidate is a network interface together with its addresses. Selection
+// works on candidates only, so that it can be done with made up interfaces
+type Candidate struct {
+	Interface net.Interface
+	Addrs     []net.Addr
+}
+
+// Candidates returns all network interfaces of this host
+func Candidates() ([]Candidate, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list network interfaces: %v", err)
+	}
+	candidates := []Candidate{}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get addresses of %s: %v", iface.Name, err)
+		}
+		candidates = append(candidates, Candidate{Interface: iface, Addrs: addrs})
+	}
+	return candidates, nil
+}
+
+// DefaultRoute returns the name of the interface of the default route or
+// the empty string if it cannot be determined, e.g. on other systems than
+// Linux. The IPv6 default route is only used if there is no IPv4 one.
+func DefaultRoute() string {
+	if name := defaultRoute(routeFile, ParseDefaultRoute); name != "" {
+		return name
+	}
+	return defaultRoute(route6File, ParseDefaultRoute6)
+}
+
+func defaultRoute(table string, parse func(io.Reader) (string, error)) string {
+	file, err := os.Open(table)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	name, _ := parse(file)
+	return name
+}
+
+// ParseDefaultRoute returns the interface of the IPv4 default route with
+// the lowest metric from a routing table in the format of /proc/net/route
+func ParseDefaultRoute(routes io.Reader) (string, error) {
+	scanner := bufio.NewScanner(routes)
+	name := ""
+	metric := -1
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		// Skip the header and incomplete lines
+		if line == 0 || len(fields) < 7 {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid flags '%s' for %s", fields[3], fields[0])
+		}
+		// Default routes have the destination 0.0.0.0 and must be up
+		if fields[1] != "00000000" || flags&0x1 == 0 {
+			continue
+		}
+		m, err := strconv.Atoi(fields[6])
+		if err != nil {
+			return "", fmt.Errorf("invalid metric '%s' for %s", fields[6], fields[0])
+		}
+		if metric < 0 || m < metric {
+			name, metric = fields[0], m
+		}
+	}
+	return name, scanner.Err()
+}
+
+// ParseDefaultRoute6 returns the interface of the IPv6 default route (::/0)
+// with the lowest metric from a routing table in the format of
+// /proc/net/ipv6_route
+func ParseDefaultRoute6(routes io.Reader) (string, error) {
+	scanner := bufio.NewScanner(routes)
+	name := ""
+	var metric uint64
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		if fields[0] != strings.Repeat("0", 32) || fields[1] != "00" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid flags '%s' for %s", fields[8], fields[9])
+		}
+		// Must be up and no reject route like the one of the loopback interface
+		if flags&0x1 == 0 || flags&0x200 != 0 {
+			continue
+		}
+		m, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid metric '%s' for %s", fields[5], fields[9])
+		}
+		if name == "" || m < metric {
+			name, metric = fields[9], m
+		}
+	}
+	return name, scanner.Err()
+}
+
+// Select picks the interfaces to watch. Configured interfaces are taken
+// as they are if usable. Otherwise the interface of the default route is
+// taken or, failing that, the first usable interface.
+func Select(configured []string, candidates []Candidate, defaultRoute string) ([]Candidate, error) {
+	if len(configured) > 0 {
+		selected := []Candidate{}
+		for _, name := range configured {
+			c, found := find(candidates, name)
+			if !found {
+				return nil, fmt.Errorf("no network interface %s (available: %s)", name, names(candidates))
+			}
+			if err := Usable(c); err != nil {
+				return nil, err
+			}
+			selected = append(selected, c)
+		}
+		return selected, nil
+	}
+
+	if c, found := find(candidates, defaultRoute); found && Usable(c) == nil {
+		return []Candidate{c}, nil
+	}
+	reasons := []string{}
+	for _, c := range candidates {
+		err := Usable(c)
+		if err == nil {
+			return []Candidate{c}, nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	return nil, fmt.Errorf("no usable network interface found, configure one with \"interface\" (%s)", strings.Join(reasons, ", "))
+}
+
+// Usable checks whether buttons can be watched on an interface. This
+// requires an Ethernet or WLAN interface which is up. IPv4 addresses are
+// not required, as ARP and DHCP packets are seen on IPv6 only hosts, too.
+func Usable(c Candidate) error {
+	iface := c.Interface
+	if iface.Flags&net.FlagLoopback != 0 {
+		return fmt.Errorf("%s is a loopback interface", iface.Name)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("%s is down", iface.Name)
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return fmt.Errorf("%s is no Ethernet interface", iface.Name)
+	}
+	return nil
+}
+
+// Describe returns the name of an interface together with its addresses
+func Describe(c Candidate) string {
+	addrs := []string{}
+	for _, addr := range c.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+	if len(addrs) == 0 {
+		return c.Interface.Name + " (no addresses)"
+	}
+	return fmt.Sprintf("%s (%s)", c.Interface.Name, strings.Join(addrs, ", "))
+}
+
+func find(candidates []Candidate, name string) (Candidate, bool) {
+	for _, c := range candidates {
+		if name != "" && c.Interface.Name == name {
+			return c, true
+		}
+	}
+	return Candidate{}, false
+}
+
+func names(candidates []Candidate) string {
+	names := []string{}
+	for _, c := range candidates {
+		names = append(names, c.Interface.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,172 @@
+package netif
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	lo = Candidate{Interface: net.Interface{Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback}}
+	// Up, but without an IPv4 address
+	eth0 = Candidate{
+		Interface: net.Interface{Index: 2, Name: "eth0", Flags: net.FlagUp | net.FlagBroadcast,
+			HardwareAddr: net.HardwareAddr{0xb8, 0x27, 0xeb, 0x01, 0x02, 0x03}},
+		Addrs: []net.Addr{&net.IPNet{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(64, 128)}},
+	}
+	wlan0 = Candidate{
+		Interface: net.Interface{Index: 3, Name: "wlan0", Flags: net.FlagUp | net.FlagBroadcast,
+			HardwareAddr: net.HardwareAddr{0xb8, 0x27, 0xeb, 0x04, 0x05, 0x06}},
+		Addrs: []net.Addr{&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}},
+	}
+	down = Candidate{Interface: net.Interface{Index: 4, Name: "eth1",
+		HardwareAddr: net.HardwareAddr{0xb8, 0x27, 0xeb, 0x07, 0x08, 0x09}}}
+	tun0 = Candidate{Interface: net.Interface{Index: 5, Name: "tun0", Flags: net.FlagUp | net.FlagPointToPoint}}
+)
+
+func TestUsable(t *testing.T) {
+	for _, c := range []struct {
+		candidate Candidate
+		reason    string
+	}{
+		{eth0, ""},
+		{wlan0, ""},
+		{lo, "loopback"},
+		{down, "down"},
+		{tun0, "no Ethernet"},
+	} {
+		err := Usable(c.candidate)
+		if c.reason == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", c.candidate.Interface.Name, err)
+		}
+		if c.reason != "" && (err == nil || !strings.Contains(err.Error(), c.reason)) {
+			t.Errorf("%s: expected error about %q, got %v", c.candidate.Interface.Name, c.reason, err)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	all := []Candidate{lo, down, tun0, eth0, wlan0}
+	for _, c := range []struct {
+		name         string
+		configured   []string
+		candidates   []Candidate
+		defaultRoute string
+		expected     string
+		err          string
+	}{
+		{"default route", nil, all, "wlan0", "wlan0", ""},
+		{"first usable without default route", nil, all, "", "eth0", ""},
+		{"unusable default route", nil, all, "tun0", "eth0", ""},
+		{"configured", []string{"wlan0", "eth0"}, all, "eth0", "wlan0, eth0", ""},
+		{"configured unknown", []string{"eth2"}, all, "", "", "no network interface eth2 (available: lo, eth1, tun0, eth0, wlan0)"},
+		{"configured unusable", []string{"eth1"}, all, "", "", "eth1 is down"},
+		{"none usable", nil, []Candidate{lo, down}, "", "", "no usable network interface found"},
+	} {
+		selected, err := Select(c.configured, c.candidates, c.defaultRoute)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if names := names(selected); names != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, names)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if d := Describe(wlan0); d != "wlan0 (192.168.1.10/24)" {
+		t.Errorf("unexpected description %s", d)
+	}
+	if d := Describe(down); d != "eth1 (no addresses)" {
+		t.Errorf("unexpected description %s", d)
+	}
+}
+
+func TestParseDefaultRoute(t *testing.T) {
+	for _, c := range []struct {
+		file  string
+		parse func(io.Reader) (string, error)
+	}{
+		{"route", ParseDefaultRoute},
+		{"ipv6_route", ParseDefaultRoute6},
+	} {
+		file, err := os.Open(filepath.Join("testdata", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := c.parse(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", c.file, err)
+		}
+		// eth0 has a lower metric than wlan0
+		if name != "eth0" {
+			t.Errorf("%s: expected default route on eth0, got %q", c.file, name)
+		}
+	}
+}
+
+func TestParseDefaultRouteWithoutDefault(t *testing.T) {
+	name, err := ParseDefaultRoute(strings.NewReader("Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\n" +
+		"eth0\t000200C0\t00000000\t0001\t0\t0\t100\n"))
+	if name != "" || err != nil {
+		t.Errorf("expected no default route, got %q (%v)", name, err)
+	}
+
+	// Only the reject route of the loopback interface
+	name, err = ParseDefaultRoute6(strings.NewReader("00000000000000000000000000000000 00 " +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200 lo\n"))
+	if name != "" || err != nil {
+		t.Errorf("expected no IPv6 default route, got %q (%v)", name, err)
+	}
+}
+
+func TestParseDefaultRouteInvalid(t *testing.T) {
+	if _, err := ParseDefaultRoute(strings.NewReader("header\neth0\t00000000\t010200C0\tXYZ\t0\t0\t0\n")); err == nil {
+		t.Error("invalid flags accepted")
+	}
+	if _, err := ParseDefaultRoute6(strings.NewReader("00000000000000000000000000000000 00 " +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 metric 00000001 00000000 00000003 eth0\n")); err == nil {
+		t.Error("invalid IPv6 metric accepted")
+	}
+}
+
+func TestParseEffectiveCaps(t *testing.T) {
+	for _, c := range []struct {
+		status  string
+		caps    uint64
+		capture bool
+	}{
+		// root
+		{"Name:\tpuffer\nCapInh:\t0000000000000000\nCapPrm:\t000001ffffffffff\nCapEff:\t000001ffffffffff\n", 0x1ffffffffff, true},
+		// setcap cap_net_raw,cap_net_admin=eip
+		{"Name:\tpuffer\nCapPrm:\t0000000000003000\nCapEff:\t0000000000003000\n", 0x3000, true},
+		// unprivileged
+		{"Name:\tpuffer\nCapEff:\t0000000000000000\n", 0, false},
+	} {
+		caps, err := ParseEffectiveCaps(strings.NewReader(c.status))
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if caps != c.caps || (caps&(1<<capNetRaw) != 0) != c.capture {
+			t.Errorf("expected capabilities %x (capture: %v), got %x", c.caps, c.capture, caps)
+		}
+	}
+
+	for _, status := range []string{"Name:\tpuffer\n", "CapEff:\tnone\n"} {
+		if _, err := ParseEffectiveCaps(strings.NewReader(status)); err == nil {
+			t.Errorf("no error for status %q", status)
+		}
+	}
+}
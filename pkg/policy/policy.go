@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/cron"
+)
+
+// Policy decides whether announcements may be spoken at a given time
+type Policy struct {
+	quietHours QuietHours
+	presence   *Presence
+
+	mutex        sync.Mutex
+	doNotDisturb bool
+}
+
+// QuietHours are time windows per day of week in which nothing should be announced
+type QuietHours map[time.Weekday][]*cron.Window
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseQuietHours parses quiet hours given per day of week ("mon", "tue", ...).
+// Days without an entry use the windows given for "default".
+func ParseQuietHours(specs map[string][]string) (QuietHours, error) {
+	q := QuietHours{}
+	defaults, err := cron.ParseWindows(specs["default"])
+	if err != nil {
+		return nil, err
+	}
+	for _, day := range weekdays {
+		q[day] = defaults
+	}
+	for key, windows := range specs {
+		if key == "default" {
+			continue
+		}
+		day, found := weekdays[strings.ToLower(key)]
+		if !found {
+			return nil, fmt.Errorf("invalid day of week '%s' for quiet hours", key)
+		}
+		if q[day], err = cron.ParseWindows(windows); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// Check returns the quiet hours the given time is in or the empty string
+func (q QuietHours) Check(at time.Time) string {
+	// Windows spanning midnight belong to the day they start on
+	for _, window := range q[at.Weekday()] {
+		if window.Contains(at) && !window.Continues(at) {
+			return "quiet hours " + window.String()
+		}
+	}
+	for _, window := range q[at.AddDate(0, 0, -1).Weekday()] {
+		if window.Continues(at) {
+			return "quiet hours " + window.String()
+		}
+	}
+	return ""
+}
+
+// New creates a policy from quiet hours. Presence detection is optional
+// and can be nil.
+func New(quietHours QuietHours, presence *Presence) *Policy {
+	return &Policy{
+		quietHours: quietHours,
+		presence:   presence,
+	}
+}
+
+// Check returns why announcements are suppressed at the given time
+// or the empty string if they are allowed
+func (p *Policy) Check(at time.Time) string {
+	if p.DoNotDisturb() {
+		return "do not disturb"
+	}
+	if reason := p.quietHours.Check(at); reason != "" {
+		return reason
+	}
+	if p.presence != nil && !p.presence.Present(at) {
+		return "nobody at home"
+	}
+	return ""
+}
+
+// SetDoNotDisturb switches "do not disturb" on or off
+func (p *Policy) SetDoNotDisturb(on bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.doNotDisturb = on
+}
+
+// DoNotDisturb returns whether "do not disturb" is switched on
+func (p *Policy) DoNotDisturb() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.doNotDisturb
+}
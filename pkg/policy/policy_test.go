@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// March 6th 2017 is a Monday
+func at(day int, hour int, minute int) time.Time {
+	return time.Date(2017, 3, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := ParseQuietHours(map[string][]string{
+		"default": {"23:00-06:00"},
+		"Mon":     {"12:00-13:00", "22:00-07:00"},
+		"sat":     {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		at       time.Time
+		expected string
+	}{
+		{at(6, 12, 30), "quiet hours 12:00-13:00"},
+		{at(6, 22, 30), "quiet hours 22:00-07:00"},
+		// The window of Monday continues on Tuesday, the default not yet
+		{at(7, 6, 30), "quiet hours 22:00-07:00"},
+		{at(7, 7, 0), ""},
+		{at(7, 12, 30), ""},
+		{at(7, 22, 30), ""},
+		{at(7, 23, 0), "quiet hours 23:00-06:00"},
+		{at(8, 5, 59), "quiet hours 23:00-06:00"},
+		// Monday morning belongs to the night of Sunday
+		{at(6, 5, 0), "quiet hours 23:00-06:00"},
+		{at(6, 6, 30), ""},
+		// No quiet hours on Saturday, but in the night of Friday
+		{at(11, 5, 0), "quiet hours 23:00-06:00"},
+		{at(11, 23, 30), ""},
+		{at(12, 5, 0), ""},
+	} {
+		if reason := q.Check(c.at); reason != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.at.Format("Mon 15:04"), c.expected, reason)
+		}
+	}
+}
+
+func TestQuietHoursInvalid(t *testing.T) {
+	for _, specs := range []map[string][]string{
+		{"monday": {"22:00-07:00"}},
+		{"default": {"22:00"}},
+		{"sun": {"22:00-25:00"}},
+	} {
+		if _, err := ParseQuietHours(specs); err == nil {
+			t.Errorf("no error for %v", specs)
+		}
+	}
+}
+
+func TestPresence(t *testing.T) {
+	p, err := NewPresence([]string{"AA:BB:CC:DD:EE:FF"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.lastSeen = at(6, 8, 0)
+	phone, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	other, _ := net.ParseMAC("11:22:33:44:55:66")
+
+	if !p.Present(at(6, 8, 59)) || p.Present(at(6, 9, 0)) {
+		t.Error("presence not timed out after an hour")
+	}
+	p.Seen(other, at(6, 9, 30))
+	if p.Present(at(6, 9, 30)) {
+		t.Error("present by an unknown device")
+	}
+	p.Seen(phone, at(6, 9, 30))
+	// Packets arriving late don't go back in time
+	p.Seen(phone, at(6, 9, 0))
+	if !p.Present(at(6, 10, 29)) || p.Present(at(6, 10, 30)) {
+		t.Error("not present within an hour after the device was seen")
+	}
+
+	if _, err := NewPresence([]string{"phone"}, time.Hour); err == nil {
+		t.Error("no error for invalid MAC address")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	q, err := ParseQuietHours(map[string][]string{"default": {"22:00-07:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	presence, err := NewPresence([]string{"aa:bb:cc:dd:ee:ff"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presence.lastSeen = at(6, 8, 0)
+	p := New(q, presence)
+
+	for _, c := range []struct {
+		at           time.Time
+		doNotDisturb bool
+		expected     string
+	}{
+		{at(6, 8, 30), false, ""},
+		{at(6, 8, 30), true, "do not disturb"},
+		{at(6, 6, 30), false, "quiet hours 22:00-07:00"},
+		{at(6, 10, 0), false, "nobody at home"},
+	} {
+		p.SetDoNotDisturb(c.doNotDisturb)
+		if reason := p.Check(c.at); reason != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.at.Format("15:04"), c.expected, reason)
+		}
+	}
+
+	if reason := New(q, nil).Check(at(6, 10, 0)); reason != "" {
+		t.Errorf("without presence detection: %q", reason)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(time.Hour)
+	q.Add("Post ist da", at(6, 22, 30))
+	q.Add("Waschmaschine fertig", at(6, 23, 30))
+	if q.Len() != 2 {
+		t.Errorf("expected 2 queued messages, got %d", q.Len())
+	}
+	// Delivered in order, the old one is dropped
+	expected := []string{"Waschmaschine fertig"}
+	if texts := q.Drain(at(7, 0, 0)); !reflect.DeepEqual(texts, expected) {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+	if texts := q.Drain(at(7, 0, 0)); len(texts) != 0 || q.Len() != 0 {
+		t.Errorf("delivered twice: %v", texts)
+	}
+
+	q.Add("Post ist da", at(7, 8, 0))
+	q.Add("Paket abholen", at(7, 8, 10))
+	expected = []string{"Post ist da", "Paket abholen"}
+	if texts := q.Drain(at(7, 9, 0)); !reflect.DeepEqual(texts, expected) {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/rhuss/puffer/pkg/logging"
+)
+
+var logger = logging.New("policy")
+
+// Presence tracks whether somebody is at home by watching for ARP and DHCP
+// packets of devices like phones
+type Presence struct {
+	devices map[string]bool
+	timeout time.Duration
+
+	mutex    sync.Mutex
+	lastSeen time.Time
+}
+
+// NewPresence creates a presence detection for the given MAC addresses.
+// Somebody is considered to be present if any device has been seen
+// within the timeout. Until then, presence is assumed.
+func NewPresence(macs []string, timeout time.Duration) (*Presence, error) {
+	devices := map[string]bool{}
+	for _, mac := range macs {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAC address for presence detection: %v", err)
+		}
+		devices[hw.String()] = true
+	}
+	return &Presence{
+		devices:  devices,
+		timeout:  timeout,
+		lastSeen: time.Now(),
+	}, nil
+}
+
+// Seen records a packet from the given MAC address
+func (p *Presence) Seen(mac net.HardwareAddr, at time.Time) {
+	if !p.devices[mac.String()] {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if at.After(p.lastSeen) {
+		p.lastSeen = at
+	}
+}
+
+// Present returns whether somebody is present at the given time
+func (p *Presence) Present(at time.Time) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return at.Sub(p.lastSeen) < p.timeout
+}
+
+// Watch sniffs the interface for ARP and DHCP packets in the background
+func (p *Presence) Watch(iface *net.Interface) error {
+	handle, err := pcap.OpenLive(iface.Name, 1600, true, pcap.BlockForever)
+	if err != nil {
+		return err
+	}
+	if err := handle.SetBPFFilter("arp or (udp and (port 67 or port 68))"); err != nil {
+		handle.Close()
+		return err
+	}
+	go func() {
+		defer handle.Close()
+		src := gopacket.NewPacketSource(handle, layers.LayerTypeEthernet)
+		for packet := range src.Packets() {
+			if eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+				p.Seen(eth.SrcMAC, packet.Metadata().Timestamp)
+			}
+		}
+		logger.Warnf("Stopped presence detection on %s", iface.Name)
+	}()
+	return nil
+}
@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"sync"
+	"time"
+)
+
+// Queue holds suppressed messages for later delivery
+type Queue struct {
+	maxAge time.Duration
+
+	mutex    sync.Mutex
+	messages []queued
+}
+
+type queued struct {
+	text string
+	at   time.Time
+}
+
+// NewQueue creates a queue dropping messages older than maxAge
+func NewQueue(maxAge time.Duration) *Queue {
+	return &Queue{maxAge: maxAge}
+}
+
+// Add queues a message
+func (q *Queue) Add(text string, at time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.messages = append(q.messages, queued{text, at})
+}
+
+// Drain removes all messages from the queue and returns those not yet expired
+func (q *Queue) Drain(now time.Time) []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	texts := []string{}
+	for _, msg := range q.messages {
+		if now.Sub(msg.at) <= q.maxAge {
+			texts = append(texts, msg.text)
+		}
+	}
+	q.messages = nil
+	return texts
+}
+
+// Len returns the number of queued messages
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.messages)
+}
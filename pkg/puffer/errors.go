@@ -0,0 +1,14 @@
+package puffer
+
+import "errors"
+
+// Kinds of errors when fetching the puffer data. They are returned as
+// Kind of a *failure.Error
+var (
+	// InfluxDB has no recent data
+	ErrNoData = errors.New("no puffer data")
+	// InfluxDB rejected the credentials
+	ErrAuth = errors.New("authentication at InfluxDB failed")
+	// InfluxDB cannot be reached or fails
+	ErrBackendUnavailable = errors.New("InfluxDB unavailable")
+)
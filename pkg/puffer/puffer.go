@@ -1,14 +1,17 @@
 package puffer
 
 import (
-	"log"
 	"fmt"
 	"net/url"
 	"net/http"
 	"encoding/json"
-	"net/http/httputil"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/logging"
 )
 
+var logger = logging.New("puffer")
+
 const QUERY_STRING = "select temp_high, temp_low, temp_med, temp_coll from puffer where time > now() - 1h order desc limit 1"
 
 type column string
@@ -42,21 +45,28 @@ func FetchPufferData(options *Options) (*Info, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, failure.New(ErrBackendUnavailable, err)
 	}
 
 	defer resp.Body.Close()
 
-	dump, _ := httputil.DumpResponse(resp, true)
-
-	log.Print(string(dump[:]))
+	logger.Debugf("InfluxDB answered with %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, failure.New(ErrAuth, fmt.Errorf("InfluxDB answered with %s", resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, failure.New(ErrBackendUnavailable, fmt.Errorf("InfluxDB answered with %s", resp.Status))
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
+		return nil, failure.New(ErrBackendUnavailable, fmt.Errorf("invalid answer: %v", err))
+	}
+	if len(data) == 0 || len(data[0].Points) == 0 {
+		return nil, failure.New(ErrNoData, fmt.Errorf("no values within the last hour"))
 	}
 
 	result := data[0]
 
-	fmt.Printf("%+v\n", result)
+	logger.Debugf("Query result: %+v", result)
 	var collector, high, med, low float32
 	for i := 0; i < len(result.Columns); i++ {
 		key := result.Columns[i]
@@ -72,7 +82,7 @@ func FetchPufferData(options *Options) (*Info, error) {
 		}
 	}
 
-	log.Printf("High: %f -- Med: %f -- Low: %f -- Collector: %f", high, med, low, collector)
+	logger.Debugf("High: %f -- Med: %f -- Low: %f -- Collector: %f", high, med, low, collector)
 
 	return &Info{
 		CollectorTemp: collector,
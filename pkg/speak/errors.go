@@ -0,0 +1,32 @@
+package speak
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rhuss/puffer/pkg/failure"
+)
+
+// Kinds of errors when speaking. They are returned as
+// Kind of a *failure.Error
+var (
+	// The speech service rejected the credentials
+	ErrAuth = errors.New("authentication at speech service failed")
+	// The speech service cannot be reached or fails
+	ErrBackendUnavailable = errors.New("speech service unavailable")
+	// The speech service or the language is unknown
+	ErrConfig = errors.New("invalid speech configuration")
+)
+
+// Messages of the speech services for rejected credentials
+var authFailures = []string{"403", "401", "UnrecognizedClient", "InvalidSignature", "AccessDenied", "SignatureDoesNotMatch"}
+
+// serviceError turns a failure of a speech service into a *failure.Error
+func serviceError(err error) error {
+	for _, message := range authFailures {
+		if strings.Contains(err.Error(), message) {
+			return failure.New(ErrAuth, err)
+		}
+	}
+	return failure.New(ErrBackendUnavailable, err)
+}
@@ -3,18 +3,22 @@ package speak
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"github.com/jpadilla/ivona-go"
+	"github.com/rhuss/puffer/pkg/failure"
 )
 
 // Speak converts a text to audio and the send it out via audio
 func IvonaSpeak(text string, options *Options) error {
-	log.Printf(">>> Ivona: %s",text)
+	logger.Infof(">>> Ivona: %s",text)
 	client := ivona.New(options.Access, options.Secret)
-	r, err := client.CreateSpeech(speechOptions(text, options.Language, options.Gender))
+	speechOptions, err := speechOptions(text, options.Language, options.Gender)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	r, err := client.CreateSpeech(speechOptions)
+	if err != nil {
+		return serviceError(err)
 	}
 
 	mp3, err := ioutil.TempFile("/tmp", "speak")
@@ -28,20 +32,14 @@ func IvonaSpeak(text string, options *Options) error {
 	}
 	defer os.Remove(mp3.Name())
 
-	playCommand := getPlayCommand(mp3.Name())
-	_, err = playCommand.CombinedOutput()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return play(mp3.Name())
 }
 
 
-func speechOptions(text string, language string, gender string) ivona.SpeechOptions {
+func speechOptions(text string, language string, gender string) (ivona.SpeechOptions, error) {
 	voice, err := createVoice(language, gender)
 	if err != nil {
-		log.Fatal(err)
+		return ivona.SpeechOptions{}, err
 	}
 	return ivona.SpeechOptions{
 		Input: &ivona.Input{
@@ -59,7 +57,7 @@ func speechOptions(text string, language string, gender string) ivona.SpeechOpti
 			ParagraphBreak: 640,
 		},
 		Voice: voice,
-	}
+	}, nil
 }
 
 func createVoice(language string, gender string) (*ivona.Voice, error) {
@@ -92,5 +90,5 @@ func createVoice(language string, gender string) (*ivona.Voice, error) {
 			Gender:   "Male",
 		}, nil
 	}
-	return nil, fmt.Errorf("Invalid language %s", language)
+	return nil, failure.New(ErrConfig, fmt.Errorf("Invalid language %s", language))
 }
@@ -1,15 +1,15 @@
 package speak
 
 import (
-	"log"
 	"github.com/leprosus/golang-tts"
 	"os"
 	"io/ioutil"
 	"fmt"
+	"github.com/rhuss/puffer/pkg/failure"
 )
 
 func PollySpeak(text string, options *Options) error {
-	log.Printf(">>> Polly: %s", text)
+	logger.Infof(">>> Polly: %s", text)
 
 	polly := golang_tts.New(options.Access, options.Secret)
 	polly.Format(golang_tts.MP3)
@@ -22,7 +22,7 @@ func PollySpeak(text string, options *Options) error {
 
 	bytes, err := polly.Speech(text)
 	if err != nil {
-		return err
+		return serviceError(err)
 	}
 
 	mp3, err := ioutil.TempFile("/tmp", "polly")
@@ -36,13 +36,7 @@ func PollySpeak(text string, options *Options) error {
 	}
 	defer os.Remove(mp3.Name())
 
-	playCommand := getPlayCommand(mp3.Name())
-	_, err = playCommand.CombinedOutput()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return play(mp3.Name())
 }
 
 func getPollyVoice(language string, gender string) (string, error) {
@@ -59,5 +53,5 @@ func getPollyVoice(language string, gender string) (string, error) {
 		}
 		return golang_tts.Joey, nil
 	}
-	return "", fmt.Errorf("Invalid language %s", language)
+	return "", failure.New(ErrConfig, fmt.Errorf("Invalid language %s", language))
 }
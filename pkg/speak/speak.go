@@ -1,9 +1,30 @@
 package speak
 
 import (
-	"log"
-	"runtime"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/logging"
+)
+
+var logger = logging.New("speak")
+
+// ErrInterrupted is returned when an announcement has been stopped
+var ErrInterrupted = errors.New("announcement interrupted")
+
+// Recorder receives the announcements of the "record" backend, one per line
+var Recorder io.Writer = os.Stdout
+
+var (
+	playMutex sync.Mutex
+	player    *exec.Cmd
+	stopped   bool
 )
 
 // Speak converts a text to audio and the send it out via audio
@@ -14,11 +35,68 @@ func Speak(text string, options *Options) error {
 	if options.Backend == "polly" {
 		return PollySpeak(text, options)
 	}
+	if options.Backend == "record" {
+		return record(text)
+	}
 
-	log.Printf(">>> Unknown backend %s. Ignoring", options.Backend)
-	return nil
+	return failure.New(ErrConfig, fmt.Errorf("unknown backend %s", options.Backend))
+}
+
+// Stop interrupts the announcement currently playing. All announcements
+// return ErrInterrupted until Resume is called
+func Stop() {
+	playMutex.Lock()
+	defer playMutex.Unlock()
+	stopped = true
+	if player != nil && player.Process != nil {
+		player.Process.Kill()
+	}
 }
 
+// Resume allows announcements again after Stop
+func Resume() {
+	playMutex.Lock()
+	defer playMutex.Unlock()
+	stopped = false
+}
+
+// play sends an mp3 file out via audio unless the announcement has been stopped
+func play(mp3 string) error {
+	playMutex.Lock()
+	if stopped {
+		playMutex.Unlock()
+		return ErrInterrupted
+	}
+	cmd := getPlayCommand(mp3)
+	if err := cmd.Start(); err != nil {
+		playMutex.Unlock()
+		return err
+	}
+	player = cmd
+	playMutex.Unlock()
+
+	err := cmd.Wait()
+
+	playMutex.Lock()
+	defer playMutex.Unlock()
+	player = nil
+	if stopped {
+		return ErrInterrupted
+	}
+	return err
+}
+
+// record writes an announcement to the Recorder instead of speaking it, e.g.
+// for testing without audio
+func record(text string) error {
+	playMutex.Lock()
+	defer playMutex.Unlock()
+	if stopped {
+		return ErrInterrupted
+	}
+	_, err := fmt.Fprintln(Recorder, text)
+	return err
+}
 
 func getPlayCommand(mp3 string) *exec.Cmd {
 	if runtime.GOOS == "darwin" {
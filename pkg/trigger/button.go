@@ -0,0 +1,150 @@
+package trigger
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/button"
+)
+
+// ButtonSource watches for presses of Dash buttons on network interfaces
+type ButtonSource struct {
+	ifaces  func() ([]*net.Interface, error)
+	names   map[string]string
+	watcher *button.Watcher
+	buttons map[string][]string
+
+	// DHCP server logs to use instead of capturing packets
+	logFile string
+	syslog  string
+	// whether the log is read for other DHCP clients than buttons
+	observing bool
+}
+
+// NewButtonSource creates a source for button triggers. The interfaces are
+// only looked up when there is something to watch for. Buttons can be
+// referenced by the given names instead of their MAC address.
+func NewButtonSource(ifaces func() ([]*net.Interface, error), names map[string]string) *ButtonSource {
+	return &ButtonSource{
+		ifaces:  ifaces,
+		names:   names,
+		watcher: button.NewWatcher(),
+		buttons: map[string][]string{},
+	}
+}
+
+// ReadLogs makes the source detect presses from the log of a DHCP server
+// instead of capturing packets, which requires no privileges. The log is
+// read by following a file and/or by receiving syslog messages on a UDP address
+func (s *ButtonSource) ReadLogs(file, syslog string) {
+	s.logFile = file
+	s.syslog = syslog
+}
+
+// ReadsLogs returns whether presses are detected from the log of a DHCP server
+func (s *ButtonSource) ReadsLogs() bool {
+	return s.logFile != "" || s.syslog != ""
+}
+
+// ObserveClients registers a function which is called for every DHCP client
+// found in the log of the DHCP server. The log is read even without buttons
+func (s *ButtonSource) ObserveClients(observe func(mac net.HardwareAddr, at time.Time)) {
+	s.observing = true
+	s.watcher.ObserveClients(observe)
+}
+
+func (s *ButtonSource) Add(trigger *Config) error {
+	mac := trigger.Mac
+	if mac == "" {
+		mac = s.names[trigger.Button]
+	}
+	if mac == "" {
+		return fmt.Errorf("no MAC address for button trigger %s", trigger.Name)
+	}
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address for button trigger %s: %v", trigger.Name, err)
+	}
+	debounce := trigger.Debounce
+	if debounce == 0 && trigger.Double != "" {
+		debounce = button.DoubleDebounce
+	}
+	if _, found := s.buttons[hw.String()]; !found {
+		if err := s.watcher.Add(trigger.Name, hw, debounce, trigger.Detect); err != nil {
+			return err
+		}
+	}
+	s.buttons[hw.String()] = append(s.buttons[hw.String()], trigger.Name)
+	return nil
+}
+
+func (s *ButtonSource) Start(events chan<- Event) error {
+	if s.ReadsLogs() && (len(s.buttons) > 0 || s.observing) {
+		return s.startLogs(events)
+	}
+	if len(s.buttons) == 0 {
+		return nil
+	}
+	ifaces, err := s.ifaces()
+	if err != nil {
+		return err
+	}
+	// A press seen on several interfaces is reported once, as the
+	// watcher debounces per button
+	presses := make(chan button.Event)
+	for _, iface := range ifaces {
+		if err := s.watcher.Watch(iface, presses); err != nil {
+			return err
+		}
+	}
+	go s.forward(presses, events)
+	return nil
+}
+
+func (s *ButtonSource) startLogs(events chan<- Event) error {
+	presses := make(chan button.Event)
+	if s.logFile != "" {
+		if err := s.watcher.Tail(s.logFile, presses); err != nil {
+			return err
+		}
+	}
+	if s.syslog != "" {
+		if err := s.watcher.ListenSyslog(s.syslog, presses); err != nil {
+			return err
+		}
+	}
+	go s.forward(presses, events)
+	return nil
+}
+
+// Replay reads the packets of a pcap file instead of watching the network
+// interface and sends the events of all presses found. It returns when the
+// whole file has been read
+func (s *ButtonSource) Replay(file string, events chan<- Event) error {
+	src, err := button.OpenPcapFile(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	presses := make(chan button.Event)
+	done := make(chan struct{})
+	go func() {
+		s.forward(presses, events)
+		close(done)
+	}()
+	err = s.watcher.Read(src, presses)
+	close(presses)
+	<-done
+	return err
+}
+
+// forward sends an event for every trigger of a pressed button
+func (s *ButtonSource) forward(presses <-chan button.Event, events chan<- Event) {
+	for press := range presses {
+		for _, name := range s.buttons[press.MAC.String()] {
+			events <- Event{Trigger: name, Time: press.Time}
+		}
+	}
+}
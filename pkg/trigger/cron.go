@@ -0,0 +1,46 @@
+package trigger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/cron"
+)
+
+// CronSource fires triggers according to cron expressions
+type CronSource struct {
+	schedules map[string]*cron.Schedule
+}
+
+func NewCronSource() *CronSource {
+	return &CronSource{
+		schedules: map[string]*cron.Schedule{},
+	}
+}
+
+func (s *CronSource) Add(trigger *Config) error {
+	schedule, err := cron.Parse(trigger.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression for trigger %s: %v", trigger.Name, err)
+	}
+	s.schedules[trigger.Name] = schedule
+	return nil
+}
+
+func (s *CronSource) Start(events chan<- Event) error {
+	for name, schedule := range s.schedules {
+		go runSchedule(name, schedule, events)
+	}
+	return nil
+}
+
+func runSchedule(name string, schedule *cron.Schedule, events chan<- Event) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		time.Sleep(next.Sub(time.Now()))
+		events <- Event{Trigger: name, Time: next}
+	}
+}
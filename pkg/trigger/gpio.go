@@ -0,0 +1,87 @@
+package trigger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const gpioPath = "/sys/class/gpio"
+
+// GPIOSource fires triggers when a GPIO input pin becomes active. The pins
+// are accessed via the Linux sysfs interface
+type GPIOSource struct {
+	pins map[int]*Config
+}
+
+func NewGPIOSource() *GPIOSource {
+	return &GPIOSource{
+		pins: map[int]*Config{},
+	}
+}
+
+func (s *GPIOSource) Add(trigger *Config) error {
+	if trigger.Pin == nil {
+		return fmt.Errorf("no pin for GPIO trigger %s", trigger.Name)
+	}
+	pin := *trigger.Pin
+	if pin < 0 {
+		return fmt.Errorf("invalid pin %d for GPIO trigger %s", pin, trigger.Name)
+	}
+	if other, found := s.pins[pin]; found {
+		return fmt.Errorf("pin %d of GPIO trigger %s is already used by %s", pin, trigger.Name, other.Name)
+	}
+	s.pins[pin] = trigger
+	return nil
+}
+
+func (s *GPIOSource) Start(events chan<- Event) error {
+	for pin, trigger := range s.pins {
+		valueFile, err := exportPin(pin)
+		if err != nil {
+			return fmt.Errorf("cannot export GPIO pin %d: %v", pin, err)
+		}
+		go pollPin(valueFile, trigger, events)
+	}
+	return nil
+}
+
+// exportPin makes the pin available as input and returns its value file
+func exportPin(pin int) (string, error) {
+	dir := filepath.Join(gpioPath, "gpio"+strconv.Itoa(pin))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(filepath.Join(gpioPath, "export"), []byte(strconv.Itoa(pin)), 0200); err != nil {
+			return "", err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "direction"), []byte("in"), 0644); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "value"), nil
+}
+
+// pollPin fires an event whenever the pin changes from inactive to active
+func pollPin(valueFile string, trigger *Config, events chan<- Event) {
+	active := []byte("1")
+	if trigger.ActiveLow {
+		active = []byte("0")
+	}
+	wasActive := true
+	for {
+		value, err := ioutil.ReadFile(valueFile)
+		if err != nil {
+			logger.Errorf("Stop watching GPIO trigger %s: %v", trigger.Name, err)
+			return
+		}
+		isActive := bytes.Equal(bytes.TrimSpace(value), active)
+		if isActive && !wasActive {
+			events <- Event{Trigger: trigger.Name, Time: time.Now()}
+		}
+		wasActive = isActive
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package trigger
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/logging"
+)
+
+// DefaultHookAddress is the address hooks are served on if none is
+// configured. Only local clients can reach it
+const DefaultHookAddress = "127.0.0.1:8089"
+
+// HTTPSource fires triggers on requests to hook URLs
+type HTTPSource struct {
+	address string
+	// Token for hooks without a token of their own
+	token string
+	hooks map[string]hook
+}
+
+type hook struct {
+	name  string
+	token string
+}
+
+// NewHTTPSource creates a source serving hooks on the given address, or on
+// DefaultHookAddress if empty. Requests must carry the token of the hook or,
+// if it has none, the given one as bearer token
+func NewHTTPSource(address string, token string) *HTTPSource {
+	if address == "" {
+		address = DefaultHookAddress
+	}
+	return &HTTPSource{
+		address: address,
+		token:   token,
+		hooks:   map[string]hook{},
+	}
+}
+
+func (s *HTTPSource) Add(trigger *Config) error {
+	if trigger.Path == "" {
+		return fmt.Errorf("no path for HTTP trigger %s", trigger.Name)
+	}
+	if other, found := s.hooks[trigger.Path]; found {
+		return fmt.Errorf("path %s of HTTP trigger %s is already used by %s", trigger.Path, trigger.Name, other.name)
+	}
+	logging.Secret(trigger.Token)
+	token := trigger.Token
+	if token == "" {
+		token = s.token
+	}
+	if token == "" {
+		return fmt.Errorf("no token for HTTP trigger %s, neither given by the trigger nor by hooks.token", trigger.Name)
+	}
+	s.hooks[trigger.Path] = hook{name: trigger.Name, token: token}
+	return nil
+}
+
+func (s *HTTPSource) Start(events chan<- Event) error {
+	if len(s.hooks) == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	for path, h := range s.hooks {
+		mux.HandleFunc(path, hookHandler(h, events))
+	}
+	go func() {
+		logger.Infof("Serving HTTP triggers on %s", s.address)
+		if err := http.ListenAndServe(s.address, mux); err != nil {
+			logger.Errorf("HTTP triggers stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func hookHandler(h hook, events chan<- Event) http.HandlerFunc {
+	expected := []byte("Bearer " + h.token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		events <- Event{Trigger: h.name, Time: time.Now(), Payload: string(body)}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
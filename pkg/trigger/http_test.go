@@ -0,0 +1,63 @@
+package trigger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPSourceRequiresToken(t *testing.T) {
+	s := NewHTTPSource("", "")
+	if s.address != DefaultHookAddress {
+		t.Errorf("hooks served on %s by default", s.address)
+	}
+	if err := s.Add(&Config{Name: "doorbell", Path: "/doorbell"}); err == nil {
+		t.Error("hook without token accepted")
+	}
+	if err := s.Add(&Config{Name: "doorbell", Path: "/doorbell", Token: "ring-ring"}); err != nil {
+		t.Error(err)
+	}
+
+	s = NewHTTPSource(":8089", "all-hooks")
+	if err := s.Add(&Config{Name: "doorbell", Path: "/doorbell"}); err != nil || s.hooks["/doorbell"].token != "all-hooks" {
+		t.Errorf("global token not used: %v", err)
+	}
+}
+
+func TestHookHandler(t *testing.T) {
+	for _, c := range []struct {
+		method        string
+		authorization string
+		code          int
+	}{
+		{"POST", "Bearer ring-ring", http.StatusAccepted},
+		{"POST", "", http.StatusUnauthorized},
+		{"POST", "Bearer ring", http.StatusUnauthorized},
+		{"POST", "ring-ring", http.StatusUnauthorized},
+		{"GET", "Bearer ring-ring", http.StatusMethodNotAllowed},
+	} {
+		events := make(chan Event, 1)
+		req := httptest.NewRequest(c.method, "/doorbell", strings.NewReader("Es klingelt"))
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		hookHandler(hook{name: "doorbell", token: "ring-ring"}, events).ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("%s with %q: expected HTTP %d, got %d", c.method, c.authorization, c.code, rec.Code)
+		}
+		select {
+		case event := <-events:
+			if c.code != http.StatusAccepted {
+				t.Errorf("%s with %q fired %v", c.method, c.authorization, event)
+			} else if event.Trigger != "doorbell" || event.Payload != "Es klingelt" {
+				t.Errorf("unexpected event %v", event)
+			}
+		default:
+			if c.code == http.StatusAccepted {
+				t.Error("hook not fired")
+			}
+		}
+	}
+}
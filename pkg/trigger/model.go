@@ -0,0 +1,65 @@
+package trigger
+
+import "time"
+
+// Config describes a trigger as given in the configuration. Which fields
+// are used depends on the type of the trigger
+type Config struct {
+	Name   string
+	Type   string
+	Action string
+
+	// button: MAC address given directly or by name from the buttons section.
+	// Action is run on a single press, Double on two presses within Window
+	// and Stop on a press while an announcement is playing. Packets within
+	// Debounce after a press belong to the same press, so it must be shorter
+	// than Window for recognizing double presses. Detect restricts the
+	// kinds of packets by which a press is detected.
+	Mac      string
+	Button   string
+	Double   string
+	Stop     string
+	Window   time.Duration
+	Debounce time.Duration
+	Detect   []string
+
+	// mqtt: topic filter, may contain wildcards
+	Topic string
+
+	// http: path of the hook and the token it requires, if different from
+	// the one given for all hooks
+	Path  string
+	Token string
+
+	// cron: cron expression and whether to skip days with an event in
+	// one of the holiday calendars
+	Cron         string
+	SkipHolidays bool `mapstructure:"skip_holidays"`
+
+	// reminder: durations like "15m" before timed events in the calendars
+	// to remind of them, for events without reminders of their own
+	Before []string
+
+	// gpio: pin number (nil if not given, as 0 is a valid pin) and whether
+	// the pin is active low
+	Pin       *int
+	ActiveLow bool `mapstructure:"active_low"`
+}
+
+// Event is emitted when a trigger fires
+type Event struct {
+	// Name of the trigger
+	Trigger string
+	Time    time.Time
+	// Payload like the body of an MQTT message or HTTP request
+	Payload string
+}
+
+// Source watches for all triggers of a specific type
+type Source interface {
+	// Add registers a trigger to watch for
+	Add(trigger *Config) error
+	// Start watches in the background and sends an event whenever a
+	// trigger fires. Sources without any trigger do nothing.
+	Start(events chan<- Event) error
+}
@@ -0,0 +1,90 @@
+package trigger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/mqtt"
+)
+
+// MQTTSource fires triggers on messages published to MQTT topics
+type MQTTSource struct {
+	options *mqtt.Options
+	topics  map[string][]string
+}
+
+// NewMQTTSource creates a source subscribing at the given broker
+func NewMQTTSource(options *mqtt.Options) *MQTTSource {
+	return &MQTTSource{
+		options: options,
+		topics:  map[string][]string{},
+	}
+}
+
+func (s *MQTTSource) Add(trigger *Config) error {
+	if trigger.Topic == "" {
+		return fmt.Errorf("no topic for MQTT trigger %s", trigger.Name)
+	}
+	s.topics[trigger.Topic] = append(s.topics[trigger.Topic], trigger.Name)
+	return nil
+}
+
+func (s *MQTTSource) Start(events chan<- Event) error {
+	if len(s.topics) == 0 {
+		return nil
+	}
+	if s.options.Broker == "" {
+		return fmt.Errorf("no MQTT broker configured")
+	}
+	go s.subscribe(events)
+	return nil
+}
+
+// subscribe receives messages and reconnects with an increasing delay
+// when the connection to the broker breaks
+func (s *MQTTSource) subscribe(events chan<- Event) {
+	filters := []string{}
+	for topic := range s.topics {
+		filters = append(filters, topic)
+	}
+	delay := time.Second
+	for {
+		subscribed, err := s.receive(filters, events)
+		if subscribed {
+			// Connected fine before, so retry quickly
+			delay = time.Second
+		}
+		logger.Warnf("MQTT connection to %s lost, retrying in %v: %v", s.options.Broker, delay, err)
+		time.Sleep(delay)
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// receive subscribes at the broker and sends events for the messages until
+// the connection breaks. It returns whether the subscription has succeeded
+func (s *MQTTSource) receive(filters []string, events chan<- Event) (bool, error) {
+	client, err := mqtt.Connect(s.options)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+	if err := client.Subscribe(filters...); err != nil {
+		return false, err
+	}
+	logger.Infof("Subscribed to %v at %s", filters, s.options.Broker)
+	for {
+		msg, err := client.Receive()
+		if err != nil {
+			return true, err
+		}
+		for filter, names := range s.topics {
+			if mqtt.Match(filter, msg.Topic) {
+				for _, name := range names {
+					events <- Event{Trigger: name, Time: time.Now(), Payload: string(msg.Payload)}
+				}
+			}
+		}
+	}
+}
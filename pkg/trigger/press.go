@@ -0,0 +1,62 @@
+package trigger
+
+import "time"
+
+// Patterns in which a button can be pressed
+const (
+	// A single press without a second one following within the window
+	PressSingle = "single"
+	// Two presses within the window
+	PressDouble = "double"
+	// A press while an announcement is still playing
+	PressStop = "stop"
+)
+
+// Classifier recognizes press patterns from the raw presses of a button.
+// It doesn't depend on any clock, so that it can be fed with synthetic timelines
+type Classifier struct {
+	// Two presses within this window are a double press. If zero,
+	// double presses are not recognized and every press is single
+	Window time.Duration
+
+	pending time.Time
+}
+
+// Press feeds a press at the given time, with playing telling whether an
+// announcement is currently playing. It returns the recognized pattern or
+// the empty string if the press is pending until the window is over. If
+// a pending press hasn't expired yet though its window is over, PressSingle
+// is returned for it and the new press is pending.
+func (c *Classifier) Press(at time.Time, playing bool) string {
+	if playing {
+		c.pending = time.Time{}
+		return PressStop
+	}
+	if c.Window == 0 {
+		return PressSingle
+	}
+	if !c.pending.IsZero() && at.Sub(c.pending) <= c.Window {
+		c.pending = time.Time{}
+		return PressDouble
+	}
+	// A press pending from before the window, as Expire hasn't been called
+	// in time, is single
+	stale := c.Expire(at)
+	c.pending = at
+	return stale
+}
+
+// Expire returns PressSingle if the window of a pending press is over at the
+// given time, the empty string otherwise
+func (c *Classifier) Expire(now time.Time) string {
+	if !c.pending.IsZero() && now.Sub(c.pending) > c.Window {
+		c.pending = time.Time{}
+		return PressSingle
+	}
+	return ""
+}
+
+// Pending returns whether a press waits for the window to be over
+func (c *Classifier) Pending() bool {
+	return !c.pending.IsZero()
+}
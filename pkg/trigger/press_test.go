@@ -0,0 +1,95 @@
+package trigger
+
+import (
+	"testing"
+	"time"
+)
+
+var pressStart = time.Date(2017, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func at(offset time.Duration) time.Time {
+	return pressStart.Add(offset)
+}
+
+func TestPressSingleWithoutWindow(t *testing.T) {
+	c := &Classifier{}
+	for _, offset := range []time.Duration{0, time.Second} {
+		if pattern := c.Press(at(offset), false); pattern != PressSingle {
+			t.Errorf("press at %s: expected %q, got %q", offset, PressSingle, pattern)
+		}
+	}
+	if c.Pending() {
+		t.Error("press pending without window")
+	}
+}
+
+func TestPressSingleAfterWindow(t *testing.T) {
+	c := &Classifier{Window: 8 * time.Second}
+	if pattern := c.Press(at(0), false); pattern != "" {
+		t.Fatalf("first press: expected pending, got %q", pattern)
+	}
+	if !c.Pending() {
+		t.Fatal("first press not pending")
+	}
+	if pattern := c.Expire(at(8 * time.Second)); pattern != "" {
+		t.Errorf("expired at end of window: %q", pattern)
+	}
+	if pattern := c.Expire(at(9 * time.Second)); pattern != PressSingle {
+		t.Errorf("after window: expected %q, got %q", PressSingle, pattern)
+	}
+	if c.Pending() {
+		t.Error("press still pending after expiry")
+	}
+	if pattern := c.Expire(at(10 * time.Second)); pattern != "" {
+		t.Errorf("expired twice: %q", pattern)
+	}
+}
+
+func TestPressDouble(t *testing.T) {
+	c := &Classifier{Window: 8 * time.Second}
+	c.Press(at(0), false)
+	if pattern := c.Press(at(6*time.Second), false); pattern != PressDouble {
+		t.Errorf("second press within window: expected %q, got %q", PressDouble, pattern)
+	}
+	if c.Pending() {
+		t.Error("press pending after double press")
+	}
+	if pattern := c.Expire(at(20 * time.Second)); pattern != "" {
+		t.Errorf("double press expired as %q", pattern)
+	}
+}
+
+func TestPressTooLateForDouble(t *testing.T) {
+	c := &Classifier{Window: 8 * time.Second}
+	c.Press(at(0), false)
+	// Without Expire in between, the first press is single and the late
+	// one starts a new window
+	if pattern := c.Press(at(10*time.Second), false); pattern != PressSingle {
+		t.Errorf("press after window: expected %q for the first press, got %q", PressSingle, pattern)
+	}
+	if !c.Pending() {
+		t.Error("press after window not pending")
+	}
+	if pattern := c.Press(at(12*time.Second), false); pattern != PressDouble {
+		t.Errorf("press within new window: expected %q, got %q", PressDouble, pattern)
+	}
+}
+
+func TestPressStop(t *testing.T) {
+	c := &Classifier{Window: 8 * time.Second}
+	if pattern := c.Press(at(0), true); pattern != PressStop {
+		t.Errorf("press while playing: expected %q, got %q", PressStop, pattern)
+	}
+
+	// A press while playing drops the pending one
+	c.Press(at(time.Minute), false)
+	if pattern := c.Press(at(time.Minute+2*time.Second), true); pattern != PressStop {
+		t.Errorf("press while playing: expected %q, got %q", PressStop, pattern)
+	}
+	if c.Pending() {
+		t.Error("press pending after stop")
+	}
+	if pattern := c.Expire(at(2 * time.Minute)); pattern != "" {
+		t.Errorf("stopped press expired as %q", pattern)
+	}
+}
@@ -0,0 +1,192 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+)
+
+// How often the calendars are polled and how far ahead at least. Events are
+// looked for four weeks ahead, the longest reminder Google calendars allow,
+// so that their own reminders fire in time. Longer ones, which other
+// calendars may have, fire as soon as their event is that close
+const (
+	reminderPoll    = 5 * time.Minute
+	reminderHorizon = 4 * 7 * 24 * time.Hour
+)
+
+// ReminderSource fires triggers before timed calendar events start. The
+// payload is the text to announce
+type ReminderSource struct {
+	fetch  func(start time.Time, end time.Time) ([]calendar.TimedEvent, error)
+	format func(event calendar.TimedEvent, until time.Duration) string
+	// Lead times per trigger, used for events without reminders of their own
+	before    map[string][]time.Duration
+	stateFile string
+	// Keys of the reminders already fired and when their events end
+	sent map[string]time.Time
+}
+
+// NewReminderSource creates a source reminding of the events returned by fetch,
+// announced as created by format. Fired reminders are remembered in the state
+// file, so that they are not repeated after a restart
+func NewReminderSource(fetch func(start time.Time, end time.Time) ([]calendar.TimedEvent, error),
+	format func(event calendar.TimedEvent, until time.Duration) string, stateFile string) *ReminderSource {
+	return &ReminderSource{
+		fetch:     fetch,
+		format:    format,
+		before:    map[string][]time.Duration{},
+		stateFile: stateFile,
+		sent:      map[string]time.Time{},
+	}
+}
+
+func (s *ReminderSource) Add(trigger *Config) error {
+	leads := []time.Duration{}
+	for _, value := range trigger.Before {
+		before, err := time.ParseDuration(value)
+		if err != nil || before < 0 {
+			return fmt.Errorf("invalid duration '%s' in before of reminder trigger %s", value, trigger.Name)
+		}
+		leads = append(leads, before)
+	}
+	s.before[trigger.Name] = leads
+	return nil
+}
+
+func (s *ReminderSource) Start(events chan<- Event) error {
+	if len(s.before) == 0 {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	go s.run(events)
+	return nil
+}
+
+func (s *ReminderSource) run(events chan<- Event) {
+	var upcoming []calendar.TimedEvent
+	var fetched time.Time
+	for {
+		now := time.Now()
+		if now.Sub(fetched) >= reminderPoll {
+			list, err := s.fetch(now, now.Add(s.horizon()))
+			if err != nil {
+				logger.Warnf("Cannot fetch events for reminders: %v", err)
+			} else {
+				upcoming, fetched = list, now
+			}
+		}
+		for _, event := range s.due(upcoming, now) {
+			events <- event
+		}
+		// Check at the start of every minute
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	}
+}
+
+// due returns the reminders to fire at now and marks them as fired. Reminders
+// missed e.g. while puffer wasn't running are fired as long as their event
+// hasn't started more than a minute ago and no other reminder of the event is
+// still to come. Of several reminders due for the same event only the last
+// one is fired
+func (s *ReminderSource) due(upcoming []calendar.TimedEvent, now time.Time) []Event {
+	ret := []Event{}
+	for name, defaults := range s.before {
+		for _, e := range upcoming {
+			if now.Sub(*e.Start) >= time.Minute {
+				continue
+			}
+			leads := e.Reminders
+			if len(leads) == 0 {
+				leads = defaults
+			}
+			pending := false
+			for _, before := range leads {
+				pending = pending || e.Start.Add(-before).After(now)
+			}
+
+			var reminder *Event
+			last := time.Duration(-1)
+			for _, before := range leads {
+				due := e.Start.Add(-before)
+				key := fmt.Sprintf("%s/%s/%s/%d/%v", name, e.Calendar, e.Summary, e.Start.Unix(), before)
+				if due.After(now) || !s.sent[key].IsZero() {
+					continue
+				}
+				s.sent[key] = *e.End
+				missed := now.Sub(due) >= time.Minute
+				if missed && pending {
+					continue
+				}
+				if last < 0 || before < last {
+					last = before
+					// Rounded to full minutes
+					until := (e.Start.Sub(now) + 30*time.Second) / time.Minute * time.Minute
+					reminder = &Event{Trigger: name, Time: due, Payload: s.format(e, until)}
+				}
+			}
+			if reminder != nil {
+				ret = append(ret, *reminder)
+			}
+		}
+	}
+	if len(ret) > 0 {
+		if err := s.save(now); err != nil {
+			logger.Warnf("Cannot save reminder state: %v", err)
+		}
+	}
+	return ret
+}
+
+// horizon returns how far to look ahead for events
+func (s *ReminderSource) horizon() time.Duration {
+	horizon := reminderHorizon
+	for _, leads := range s.before {
+		for _, before := range leads {
+			if before > horizon {
+				horizon = before
+			}
+		}
+	}
+	return horizon + reminderPoll
+}
+
+func (s *ReminderSource) load() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.sent); err != nil {
+		return fmt.Errorf("invalid reminder state in %s: %v", s.stateFile, err)
+	}
+	return nil
+}
+
+// save writes the fired reminders, dropping those of events which are over
+func (s *ReminderSource) save(now time.Time) error {
+	for key, end := range s.sent {
+		if end.Before(now) {
+			delete(s.sent, key)
+		}
+	}
+	if s.stateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.sent)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.stateFile, data, 0600)
+}
@@ -0,0 +1,93 @@
+package trigger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rhuss/puffer/pkg/calendar"
+)
+
+func reminderSource(t *testing.T, stateFile string, before ...string) *ReminderSource {
+	s := NewReminderSource(nil, func(event calendar.TimedEvent, until time.Duration) string {
+		return event.Summary + " in " + until.String()
+	}, stateFile)
+	if err := s.Add(&Config{Name: "reminder", Before: before}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func timedEvent(summary string, start time.Time, reminders ...time.Duration) calendar.TimedEvent {
+	end := start.Add(time.Hour)
+	return calendar.TimedEvent{Start: &start, End: &end, Event: calendar.Event{Summary: summary, Reminders: reminders}}
+}
+
+func TestReminderHorizonCoversEventReminders(t *testing.T) {
+	s := reminderSource(t, "", "15m")
+	// Google calendars allow reminders up to four weeks before
+	if horizon := s.horizon(); horizon < 4*7*24*time.Hour+reminderPoll {
+		t.Errorf("reminders of four weeks before not fetched in time, horizon is %v", horizon)
+	}
+	if err := s.Add(&Config{Name: "long", Before: []string{"1000h"}}); err != nil {
+		t.Fatal(err)
+	}
+	if horizon := s.horizon(); horizon != 1000*time.Hour+reminderPoll {
+		t.Errorf("expected horizon of the longest lead time, got %v", horizon)
+	}
+}
+
+func TestReminderDue(t *testing.T) {
+	s := reminderSource(t, "", "15m")
+	start := pressStart.Add(2 * 24 * time.Hour)
+	upcoming := []calendar.TimedEvent{
+		timedEvent("Zahnarzt", start, 2*24*time.Hour, 30*time.Minute),
+		timedEvent("Chor", start.Add(2*time.Hour)),
+	}
+
+	// The event's own reminder two days ahead
+	events := s.due(upcoming, pressStart)
+	if len(events) != 1 || events[0].Payload != "Zahnarzt in 48h0m0s" {
+		t.Fatalf("unexpected reminders %v", events)
+	}
+	if events := s.due(upcoming, pressStart.Add(30*time.Second)); len(events) != 0 {
+		t.Errorf("reminder repeated: %v", events)
+	}
+	// The default lead time for the event without reminders
+	events = s.due(upcoming, start.Add(105*time.Minute))
+	if len(events) != 1 || events[0].Payload != "Chor in 15m0s" {
+		t.Errorf("unexpected reminders %v", events)
+	}
+}
+
+func TestReminderStateIsPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reminder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "reminders.json")
+	s := reminderSource(t, file, "15m")
+	start := pressStart.Add(10 * time.Minute)
+	if events := s.due([]calendar.TimedEvent{timedEvent("Zahnarzt", start)}, pressStart); len(events) != 1 {
+		t.Fatalf("unexpected reminders %v", events)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("state readable by others: %v", perm)
+	}
+	// Not repeated after a restart
+	s = reminderSource(t, file, "15m")
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if events := s.due([]calendar.TimedEvent{timedEvent("Zahnarzt", start)}, pressStart.Add(time.Minute)); len(events) != 0 {
+		t.Errorf("reminder repeated after restart: %v", events)
+	}
+}
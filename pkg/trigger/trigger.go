@@ -0,0 +1,35 @@
+package trigger
+
+import (
+	"fmt"
+
+	"github.com/rhuss/puffer/pkg/failure"
+	"github.com/rhuss/puffer/pkg/logging"
+)
+
+var logger = logging.New("trigger")
+
+// Sources maps trigger types to the source watching for them
+type Sources map[string]Source
+
+// Add registers a trigger with the source for its type
+func (s Sources) Add(trigger *Config) error {
+	if trigger.Name == "" {
+		return fmt.Errorf("trigger of type %s has no name", trigger.Type)
+	}
+	source, found := s[trigger.Type]
+	if !found {
+		return fmt.Errorf("unknown type '%s' for trigger %s", trigger.Type, trigger.Name)
+	}
+	return source.Add(trigger)
+}
+
+// Start starts all sources
+func (s Sources) Start(events chan<- Event) error {
+	for kind, source := range s {
+		if err := source.Start(events); err != nil {
+			return failure.Wrapf(err, "cannot start %s triggers", kind)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package wyoming
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Event is a single message of the Wyoming protocol as used by Rhasspy
+// and Home Assistant. On the wire it is a JSON header line, optionally followed
+// by additional data and a binary payload
+type Event struct {
+	Type    string                 `json:"type"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Payload []byte                 `json:"-"`
+}
+
+// Limits for the parts of an event, as their lengths are given by the peer.
+// Intent handling only receives short texts, so these are generous
+const (
+	MaxHeaderLength  = 64 * 1024
+	MaxDataLength    = 64 * 1024
+	MaxPayloadLength = 1024 * 1024
+)
+
+type header struct {
+	Type          string                 `json:"type"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	DataLength    int                    `json:"data_length,omitempty"`
+	PayloadLength int                    `json:"payload_length,omitempty"`
+}
+
+// ReadEvent reads the next event from the given reader. Events exceeding
+// the limits above are rejected
+func ReadEvent(r *bufio.Reader) (*Event, error) {
+	line, err := readLine(r, MaxHeaderLength)
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, fmt.Errorf("invalid event header: %v", err)
+	}
+	if h.DataLength < 0 || h.PayloadLength < 0 {
+		return nil, fmt.Errorf("invalid lengths of event %s (data: %d bytes, payload: %d bytes)", h.Type, h.DataLength, h.PayloadLength)
+	}
+	if h.DataLength > MaxDataLength || h.PayloadLength > MaxPayloadLength {
+		return nil, fmt.Errorf("event %s too large (data: %d bytes, payload: %d bytes)", h.Type, h.DataLength, h.PayloadLength)
+	}
+	event := &Event{
+		Type: h.Type,
+		Data: h.Data,
+	}
+	if h.DataLength > 0 {
+		data := make([]byte, h.DataLength)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		extra := map[string]interface{}{}
+		if err := json.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("invalid event data: %v", err)
+		}
+		if event.Data == nil {
+			event.Data = extra
+		} else {
+			for k, v := range extra {
+				event.Data[k] = v
+			}
+		}
+	}
+	if h.PayloadLength > 0 {
+		event.Payload = make([]byte, h.PayloadLength)
+		if _, err := io.ReadFull(r, event.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// readLine reads up to the next newline, failing for lines longer than max
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return nil, fmt.Errorf("event header longer than %d bytes", max)
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// WriteEvent writes an event to the given writer
+func WriteEvent(w io.Writer, event *Event) error {
+	h := header{
+		Type:          event.Type,
+		Data:          event.Data,
+		PayloadLength: len(event.Payload),
+	}
+	line, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if len(event.Payload) > 0 {
+		_, err = w.Write(event.Payload)
+	}
+	return err
+}
+
+// String returns a string value of the event's data or "" if not present
+func (e *Event) String(key string) string {
+	if v, ok := e.Data[key].(string); ok {
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package wyoming
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadEvent(t *testing.T) {
+	input := `{"type": "transcript", "data": {"text": "Wie warm?"}, "data_length": 18, "payload_length": 3}` + "\n" +
+		`{"language": "de"}` + "abc" +
+		`{"type": "describe"}` + "\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	event, err := ReadEvent(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "transcript" || event.String("text") != "Wie warm?" || event.String("language") != "de" || string(event.Payload) != "abc" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event, err = ReadEvent(r); err != nil || event.Type != "describe" {
+		t.Errorf("unexpected second event %+v (%v)", event, err)
+	}
+}
+
+func TestReadEventLimits(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		input string
+	}{
+		{"header", `{"type": "` + strings.Repeat("x", MaxHeaderLength) + `"}` + "\n"},
+		{"header without newline", strings.Repeat("x", MaxHeaderLength+1)},
+		{"data", fmt.Sprintf(`{"type": "transcript", "data_length": %d}`+"\n", MaxDataLength+1)},
+		{"payload", fmt.Sprintf(`{"type": "audio-chunk", "payload_length": %d}`+"\n", MaxPayloadLength+1)},
+		{"negative data", `{"type": "transcript", "data_length": -1}` + "\n"},
+		{"negative payload", `{"type": "audio-chunk", "payload_length": -5}` + "\n"},
+		{"truncated payload", `{"type": "audio-chunk", "payload_length": 10}` + "\nabc"},
+		{"invalid header", "type: transcript\n"},
+		{"invalid data", `{"type": "transcript", "data_length": 3}` + "\nabc"},
+	} {
+		if event, err := ReadEvent(bufio.NewReader(strings.NewReader(c.input))); err == nil {
+			t.Errorf("%s: no error, got %+v", c.name, event)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	event := &Event{Type: "synthesize", Data: map[string]interface{}{"text": "Puffer"}, Payload: []byte("pcm")}
+	if err := WriteEvent(&buf, event); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEvent(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Type != event.Type || read.String("text") != "Puffer" || string(read.Payload) != "pcm" {
+		t.Errorf("expected %+v, got %+v", event, read)
+	}
+}